@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
+	"github.com/logicmonitor/k8s-release-manager/pkg/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var azureAccount string
+var azureAccountKey string
+var azureContainer string
+var azureEndpoint string
+var azureSASToken string
+
+func azurePreRun(cmd *cobra.Command) {
+	azureOpts := &backend.AzureOpts{
+		Account: viper.GetString("azureAccount"),
+		Auth: &backend.AzureAuth{
+			AccountKey: viper.GetString("azureAccountKey"),
+			SASToken:   viper.GetString("azureSASToken"),
+		},
+		Container: viper.GetString("azureContainer"),
+		Endpoint:  viper.GetString("azureEndpoint"),
+	}
+
+	valid := validateAzureAuth(azureOpts) && validateAzureConfig(azureOpts)
+	if !valid {
+		failAuth(cmd)
+	}
+
+	mgrstate = &state.State{
+		Backend: decorateBackend(&backend.Azure{
+			BackendConfig: rlsmgrconfig.Backend,
+			Opts:          azureOpts,
+		}),
+		Config: rlsmgrconfig,
+	}
+
+	err := mgrstate.Backend.Init(commandContext())
+	if err != nil {
+		log.Fatalf("Failed to initialize the Azure backend: %v", err)
+	}
+
+	err = mgrstate.Init()
+	if err != nil {
+		log.Fatalf("Failed to initialize state: %v", err)
+	}
+}
+
+var azureExportCmd = &cobra.Command{ // nolint: dupl
+	Use:   "azure",
+	Short: "Export state using the Azure backend",
+	Long: `Export state using the Azure Blob Storage backend
+Run: ` + RootCmd.Name() + ` export --help for more information about exporting`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		exportCmd.PreRun(cmd, args)
+		azurePreRun(cmd)
+	},
+	Run: exportRun,
+}
+
+var azureClearCmd = &cobra.Command{ // nolint: dupl
+	Use:   "azure",
+	Short: "Clear state from the Azure backend",
+	Long: `Clear state from the Azure Blob Storage backend
+Run: ` + RootCmd.Name() + ` clear --help for more information about clearing
+state`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		clearCmd.PreRun(cmd, args)
+		azurePreRun(cmd)
+	},
+	Run: clearRun,
+}
+
+var azureMigrateCmd = &cobra.Command{ // nolint: dupl
+	Use:   "azure",
+	Short: "Migrate state from the Azure backend",
+	Long: `Migrate state from the Azure Blob Storage backend
+Run: ` + RootCmd.Name() + ` migrate --help for more information about migrating
+state`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		migrateCmd.PreRun(cmd, args)
+		azurePreRun(cmd)
+	},
+	Run: migrateRun,
+}
+
+var azureImportCmd = &cobra.Command{ // nolint: dupl
+	Use:   "azure",
+	Short: "Import state from the Azure backend",
+	Long: `Import state from the Azure Blob Storage backend
+Run: ` + RootCmd.Name() + ` import --help for more information about importing`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		importCmd.PreRun(cmd, args)
+		azurePreRun(cmd)
+	},
+	Run: importRun,
+}
+
+func azureFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVarP(&azureAccount, "account", "", "", "Required. Use this Azure storage account for backend storage")
+	cmd.PersistentFlags().StringVarP(&azureAccountKey, "accountKey", "", "", "An Azure storage account shared key for accessing the container")
+	cmd.PersistentFlags().StringVarP(&azureContainer, "container", "", "", "Required. Use this Azure Blob Storage container for backend storage")
+	cmd.PersistentFlags().StringVarP(&azureEndpoint, "endpoint", "", "", "A custom Blob service endpoint, e.g. http://127.0.0.1:10000/devstoreaccount1 for Azurite. The default is https://<account>.blob.core.windows.net")
+	cmd.PersistentFlags().StringVarP(&azureSASToken, "sasToken", "", "", "An Azure shared access signature token for accessing the container")
+	err := bindConfigFlags(cmd, map[string]string{
+		"azureAccount":    "account",
+		"azureAccountKey": "accountKey",
+		"azureContainer":  "container",
+		"azureEndpoint":   "endpoint",
+		"azureSASToken":   "sasToken",
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	azureFlags(azureClearCmd)
+	azureFlags(azureExportCmd)
+	azureFlags(azureImportCmd)
+	azureFlags(azureMigrateCmd)
+	exportCmd.AddCommand(azureExportCmd)
+	importCmd.AddCommand(azureImportCmd)
+	clearCmd.AddCommand(azureClearCmd)
+	migrateCmd.AddCommand(azureMigrateCmd)
+}
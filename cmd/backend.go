@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
+	"github.com/logicmonitor/k8s-release-manager/pkg/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var encrypted *backend.Encrypted
+
+// storedBackend is the backend without the decorators that transform the
+// stored contents, used to copy files as they are stored
+var storedBackend backend.Backend
+
+// backendRun returns the Run func of a command used without a backend
+// subcommand, which configures the backend from the --backend URL
+func backendRun(run func(*cobra.Command, []string)) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		backendPreRun(cmd)
+		run(cmd, args)
+	}
+}
+
+func backendPreRun(cmd *cobra.Command) {
+	if rlsmgrconfig.Backend.URL == "" {
+		fmt.Println("You must specify --backend or a backend subcommand")
+		failAuth(cmd)
+	}
+
+	b, err := backend.FromURL(rlsmgrconfig.Backend.URL, rlsmgrconfig.Backend)
+	if err != nil {
+		log.Fatalf("Failed to create the backend: %v", err)
+	}
+
+	mgrstate = &state.State{
+		Backend: decorateBackend(b),
+		Config:  rlsmgrconfig,
+	}
+
+	err = mgrstate.Backend.Init(commandContext())
+	if err != nil {
+		log.Fatalf("Failed to initialize the backend: %v", err)
+	}
+
+	err = mgrstate.Init()
+	if err != nil {
+		log.Fatalf("Failed to initialize state: %v", err)
+	}
+}
+
+// decorateBackend wraps the backend with the decorators enabled by the
+// backend flags common to every subcommand
+func decorateBackend(b backend.Backend) backend.Backend {
+	_, local := b.(*backend.Local)
+	b = retrying(b)
+	storedBackend = b
+
+	// the cache holds stored, i.e. encrypted, contents. local files don't
+	// need caching.
+	if rlsmgrconfig.Backend.Cache.Dir != "" && !local {
+		b = &backend.Cached{
+			Backend: b,
+			Opts:    rlsmgrconfig.Backend.Cache,
+		}
+	}
+
+	// mirrors receive the same encrypted and compressed contents
+	if len(rlsmgrconfig.Backend.Mirror.Paths) > 0 {
+		b = mirror(b)
+	}
+
+	if rlsmgrconfig.Backend.Encryption.Enabled() {
+		encrypted = &backend.Encrypted{
+			Backend: b,
+			Opts:    rlsmgrconfig.Backend.Encryption,
+		}
+		b = encrypted
+	}
+
+	// compression is applied outside of encryption since ciphertext doesn't compress
+	return &backend.Compressed{
+		Algorithm: rlsmgrconfig.Backend.Compression,
+		Backend:   b,
+	}
+}
+
+// retrying wraps the backend with retries if enabled. Retries are applied
+// innermost so only the failed request is repeated.
+func retrying(b backend.Backend) backend.Backend {
+	if rlsmgrconfig.Backend.Retry.MaxAttempts <= 1 {
+		return b
+	}
+	return &backend.Retrying{
+		Backend: b,
+		Opts:    rlsmgrconfig.Backend.Retry,
+	}
+}
+
+// mirror returns a backend that writes to the primary backend and to each
+// mirror target. Targets are backend URLs, e.g. s3://bucket/path, or local
+// paths, which use the local backend's file modes.
+func mirror(primary backend.Backend) backend.Backend {
+	m := &backend.Mirror{
+		Consistency: rlsmgrconfig.Backend.Mirror.Consistency,
+		Targets:     []*backend.MirrorTarget{{Backend: primary, Name: "primary"}},
+	}
+
+	for _, target := range rlsmgrconfig.Backend.Mirror.Paths {
+		cfg := *rlsmgrconfig.Backend
+		cfg.URL = ""
+		if !strings.Contains(target, "://") {
+			cfg.StoragePath = target
+			m.Targets = append(m.Targets, &backend.MirrorTarget{
+				Backend: retrying(&backend.Local{
+					BackendConfig: &cfg,
+					Opts:          localMirrorOpts(),
+				}),
+				Name: "local:" + target,
+			})
+			continue
+		}
+
+		b, err := backend.FromURL(target, &cfg)
+		if err != nil {
+			log.Fatalf("Failed to create mirror target: %v", err)
+		}
+		u, _ := url.Parse(target)
+		m.Targets = append(m.Targets, &backend.MirrorTarget{
+			Backend: retrying(b),
+			// the query may hold credentials
+			Name: u.Scheme + "://" + u.Host + u.Path,
+		})
+	}
+	return m
+}
+
+// localMirrorOpts returns the file modes configured for the local backend,
+// or the defaults if they're invalid
+func localMirrorOpts() *backend.LocalOpts {
+	opts := &backend.LocalOpts{}
+	if mode, err := strconv.ParseUint(viper.GetString("localDirMode"), 8, 32); err == nil && mode <= 0777 {
+		opts.DirMode = os.FileMode(mode)
+	}
+	if mode, err := strconv.ParseUint(viper.GetString("localFileMode"), 8, 32); err == nil && mode <= 0777 {
+		opts.FileMode = os.FileMode(mode)
+	}
+	return opts
+}
+
+// reencrypt re-encrypts stored files that aren't encrypted with the current key
+func reencrypt() error {
+	if encrypted == nil {
+		return fmt.Errorf("--reencrypt requires --encryptionKeyFile or --ageRecipients")
+	}
+	if rlsmgrconfig.DryRun {
+		fmt.Println("Dry run. Skipping re-encryption.")
+		return nil
+	}
+	return encrypted.Rotate(commandContext())
+}
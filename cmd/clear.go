@@ -10,6 +10,7 @@ var clearCmd = &cobra.Command{
 	Use:    "clear",
 	Short:  "Clear all state",
 	PreRun: func(cmd *cobra.Command, args []string) {},
+	Run:    backendRun(clearRun),
 }
 
 func init() {
@@ -23,7 +24,7 @@ func clearRun(cmd *cobra.Command, args []string) { //nolint: dupl
 		log.Fatalf("Failed to create Release Manager deleter: %v", err)
 	}
 
-	err = delete.Run()
+	err = delete.Run(commandContext())
 	if err != nil {
 		log.Errorf("%v", err)
 	}
@@ -13,7 +13,7 @@ var docsCmd = &cobra.Command{
 	Use:   "docs",
 	Short: "Generate the Release Manager documentation",
 	Run: func(cmd *cobra.Command, args []string) {
-		err := utilities.EnsureDirectory(docsPath)
+		err := utilities.EnsureDirectory(docsPath, 0755)
 		if err != nil {
 			log.Warnf("%v", err)
 		}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/logicmonitor/k8s-release-manager/pkg/config"
 	"github.com/logicmonitor/k8s-release-manager/pkg/export"
@@ -13,11 +14,17 @@ import (
 )
 
 var allNamespaces bool
+var clusterName string
 var daemon bool
 var deployed bool
 var failed bool
+var leaseDurationSec int
 var mgrstate *state.State
 var pollingInterval int
+var reencryptFiles bool
+var signingKeyFile string
+var stealLock bool
+var exportTimeoutSec int
 
 var exportCmd = &cobra.Command{
 	Use:   "export",
@@ -38,7 +45,15 @@ Installing releasemanager daemon via Helm chart
 When running in daemon mode, it is HIGHLY recommended to use the
 official Release Manager Helm chart. Failing to specify --release-name or
 use the official Helm chart can lead to multiple Release Manager instances
-writing state to the same backend path, causing conflicts, overwrites, chaos.`,
+writing state to the same backend path, causing conflicts, overwrites, chaos.
+To prevent this, export holds a lock on the backend path while it runs and
+waits for a lock held by another instance to expire, up to --lease-duration
+if the other instance keeps renewing it, before refusing to start. Use
+--steal-lock to take over a lock left behind by an instance that no longer
+exists.
+
+Use --signing-key-file to sign the checksum manifest of the stored releases,
+so import can verify that they were exported by a trusted Release Manager.`,
 	PreRun: func(cmd *cobra.Command, args []string) {
 		valid := validateCommonConfig()
 		if !valid {
@@ -46,10 +61,16 @@ writing state to the same backend path, causing conflicts, overwrites, chaos.`,
 		}
 
 		rlsmgrconfig.Export = &config.ExportConfig{
+			ClusterName:     viper.GetString("clusterName"),
 			DaemonMode:      viper.GetBool("daemon"),
+			LeaseDuration:   time.Duration(viper.GetInt64("leaseDuration")) * time.Second,
 			ReleaseName:     viper.GetString("releaseName"),
 			PollingInterval: viper.GetInt64("pollingInterval"),
 			Namespaces:      viper.GetStringSlice("namespaces"),
+			Reencrypt:       viper.GetBool("reencrypt"),
+			SigningKeyFile:  viper.GetString("signingKeyFile"),
+			StealLock:       viper.GetBool("stealLock"),
+			Timeout:         time.Duration(viper.GetInt64("exportTimeout")) * time.Second,
 		}
 
 		// Passing in here,may make flags but should always be true for these settings
@@ -58,19 +79,37 @@ writing state to the same backend path, causing conflicts, overwrites, chaos.`,
 			Failed:        true,
 			AllNamespaces: true,
 		}
+
+		valid = validateExportConfig()
+		if !valid {
+			failAuth(cmd)
+		}
 	},
+	Run: backendRun(exportRun),
 }
 
 func init() { // nolint: dupl
+	exportCmd.PersistentFlags().StringVarP(&clusterName, "cluster-name", "", "", "The cluster name attached to stored files as metadata. The default is the address of the cluster's API server")
 	exportCmd.PersistentFlags().BoolVarP(&daemon, "daemon", "", false, "Run in daemon mode and periodically export the current state")
+	exportCmd.PersistentFlags().IntVarP(&leaseDurationSec, "lease-duration", "", 120, "The time, in seconds, that the backend path's lock is held without being renewed. Export waits this long for a lock held by another instance to expire")
 	exportCmd.PersistentFlags().IntVarP(&pollingInterval, "polling-interval", "p", 30, "Specify, in seconds, how frequently the daemon should export the current state")
 	exportCmd.PersistentFlags().StringVarP(&releaseName, "release-name", "", "", "Specify the Release Manager daemon's Helm release name")
+	exportCmd.PersistentFlags().IntVarP(&exportTimeoutSec, "export-timeout", "", 600, "The time, in seconds, after which an export is abandoned and reported as a failure. Set to 0 to wait indefinitely")
+	exportCmd.PersistentFlags().BoolVarP(&reencryptFiles, "reencrypt", "", false, "Before exporting, re-encrypt stored files that aren't encrypted with the current key")
+	exportCmd.PersistentFlags().StringVarP(&signingKeyFile, "signing-key-file", "", "", "Sign the checksum manifest with the PEM encoded ed25519 private key in this file")
+	exportCmd.PersistentFlags().BoolVarP(&stealLock, "steal-lock", "", false, "Take over the backend path's lock even if another Release Manager holds it")
 	exportCmd.PersistentFlags().StringSliceP("namespaces", "", []string{}, "A list of namespaces to export. The default behavior is to export all namespaces")
 	err := bindConfigFlags(exportCmd, map[string]string{
+		"clusterName":     "cluster-name",
 		"daemon":          "daemon",
+		"exportTimeout":   "export-timeout",
+		"leaseDuration":   "lease-duration",
 		"pollingInterval": "polling-interval",
 		"releaseName":     "release-name",
 		"namespaces":      "namespaces",
+		"reencrypt":       "reencrypt",
+		"signingKeyFile":  "signing-key-file",
+		"stealLock":       "steal-lock",
 	})
 	if err != nil {
 		fmt.Println(err)
@@ -86,7 +125,21 @@ func exportRun(cmd *cobra.Command, args []string) { // nolint: dupl
 		log.Fatalf("Failed to create Release Manager exporter: %v", err)
 	}
 
-	err = export.Run()
+	if rlsmgrconfig.Export.SigningKeyFile != "" {
+		mgrstate.Releases.SigningKey, err = state.LoadSigningKey(rlsmgrconfig.Export.SigningKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load signing key: %v", err)
+		}
+	}
+
+	if rlsmgrconfig.Export.Reencrypt {
+		err = reencrypt()
+		if err != nil {
+			log.Fatalf("Failed to re-encrypt stored files: %v", err)
+		}
+	}
+
+	err = export.Run(commandContext())
 	if err != nil {
 		log.Errorf("%v", err)
 	}
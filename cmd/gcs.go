@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
+	"github.com/logicmonitor/k8s-release-manager/pkg/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var gcsAnonymous bool
+var gcsBucket string
+var gcsCredentialsFile string
+var gcsEndpoint string
+
+func gcsPreRun(cmd *cobra.Command) {
+	gcsOpts := &backend.GCSOpts{
+		Auth: &backend.GCSAuth{
+			Anonymous:       viper.GetBool("gcsAnonymous"),
+			CredentialsFile: viper.GetString("gcsCredentialsFile"),
+		},
+		Bucket:   viper.GetString("gcsBucket"),
+		Endpoint: viper.GetString("gcsEndpoint"),
+	}
+
+	valid := validateGCSAuth(gcsOpts) && validateGCSConfig(gcsOpts)
+	if !valid {
+		failAuth(cmd)
+	}
+
+	mgrstate = &state.State{
+		Backend: decorateBackend(&backend.GCS{
+			BackendConfig: rlsmgrconfig.Backend,
+			Opts:          gcsOpts,
+		}),
+		Config: rlsmgrconfig,
+	}
+
+	err := mgrstate.Backend.Init(commandContext())
+	if err != nil {
+		log.Fatalf("Failed to initialize the GCS backend: %v", err)
+	}
+
+	err = mgrstate.Init()
+	if err != nil {
+		log.Fatalf("Failed to initialize state: %v", err)
+	}
+}
+
+var gcsExportCmd = &cobra.Command{ // nolint: dupl
+	Use:   "gcs",
+	Short: "Export state using the GCS backend",
+	Long: `Export state using the Google Cloud Storage backend
+Run: ` + RootCmd.Name() + ` export --help for more information about exporting`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		exportCmd.PreRun(cmd, args)
+		gcsPreRun(cmd)
+	},
+	Run: exportRun,
+}
+
+var gcsClearCmd = &cobra.Command{ // nolint: dupl
+	Use:   "gcs",
+	Short: "Clear state from the GCS backend",
+	Long: `Clear state from the Google Cloud Storage backend
+Run: ` + RootCmd.Name() + ` clear --help for more information about clearing
+state`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		clearCmd.PreRun(cmd, args)
+		gcsPreRun(cmd)
+	},
+	Run: clearRun,
+}
+
+var gcsMigrateCmd = &cobra.Command{ // nolint: dupl
+	Use:   "gcs",
+	Short: "Migrate state from the GCS backend",
+	Long: `Migrate state from the Google Cloud Storage backend
+Run: ` + RootCmd.Name() + ` migrate --help for more information about migrating
+state`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		migrateCmd.PreRun(cmd, args)
+		gcsPreRun(cmd)
+	},
+	Run: migrateRun,
+}
+
+var gcsImportCmd = &cobra.Command{ // nolint: dupl
+	Use:   "gcs",
+	Short: "Import state from the GCS backend",
+	Long: `Import state from the Google Cloud Storage backend
+Run: ` + RootCmd.Name() + ` import --help for more information about importing`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		importCmd.PreRun(cmd, args)
+		gcsPreRun(cmd)
+	},
+	Run: importRun,
+}
+
+func gcsFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVarP(&gcsAnonymous, "anonymous", "", false, "Send unauthenticated requests, e.g. to a local fake GCS server")
+	cmd.PersistentFlags().StringVarP(&gcsBucket, "bucket", "", "", "Required. Use this GCS bucket for backend storage")
+	cmd.PersistentFlags().StringVarP(&gcsCredentialsFile, "credentialsFile", "", "", "A service account JSON key file for accessing the GCS bucket, otherwise use the application default credentials")
+	cmd.PersistentFlags().StringVarP(&gcsEndpoint, "endpoint", "", "", "A custom GCS API endpoint, e.g. http://localhost:4443/storage/v1/")
+	err := bindConfigFlags(cmd, map[string]string{
+		"gcsAnonymous":       "anonymous",
+		"gcsBucket":          "bucket",
+		"gcsCredentialsFile": "credentialsFile",
+		"gcsEndpoint":        "endpoint",
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	gcsFlags(gcsClearCmd)
+	gcsFlags(gcsExportCmd)
+	gcsFlags(gcsImportCmd)
+	gcsFlags(gcsMigrateCmd)
+	exportCmd.AddCommand(gcsExportCmd)
+	importCmd.AddCommand(gcsImportCmd)
+	clearCmd.AddCommand(gcsClearCmd)
+	migrateCmd.AddCommand(gcsMigrateCmd)
+}
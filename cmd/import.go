@@ -7,12 +7,14 @@ import (
 
 	"github.com/logicmonitor/k8s-release-manager/pkg/config"
 	"github.com/logicmonitor/k8s-release-manager/pkg/importt"
+	"github.com/logicmonitor/k8s-release-manager/pkg/state"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-var force bool
+var allowUnsigned, allowUnverified, force bool
+var trustedKeyFiles []string
 var newStoragePath, namespace, target string
 var releaseTimeoutSec, threads int
 var values map[string]string
@@ -34,6 +36,12 @@ in the remote state, and --new-path is not set, this command will fail. If
 you're really sure that this is an operation you want to perform (it probably
 isn't), you can set --force to ignore safety checks.
 
+Stored releases are verified against the checksum manifest written by export
+before anything is installed. If a file doesn't match the manifest, or the
+manifest is missing, this command will fail unless --allow-unverified is set.
+The manifest must also be signed by one of the keys in --trusted-keys, unless
+--allow-unsigned is set, e.g. for releases exported without a signing key.
+
 Import is designed to fail if a release already exists with the same name as
 a stored release. This is by design. If you want to overwrite an existing
 release, you should use the helm delete --purge to delete it first.`,
@@ -45,6 +53,8 @@ release, you should use the helm delete --purge to delete it first.`,
 
 		_ = viper.GetStringMapString("valueUpdates")
 		rlsmgrconfig.Import = &config.ImportConfig{
+			AllowUnsigned:     viper.GetBool("allowUnsigned"),
+			AllowUnverified:   viper.GetBool("allowUnverified"),
 			Force:             viper.GetBool("force"),
 			NewStoragePath:    viper.GetString("newPath"),
 			Namespace:         viper.GetString("namespace"),
@@ -52,6 +62,7 @@ release, you should use the helm delete --purge to delete it first.`,
 			Values:            values,
 			ExcludeNamespaces: viper.GetStringSlice("excludeNamespaces"),
 			Threads:           viper.GetInt64("threads"),
+			TrustedKeyFiles:   viper.GetStringSlice("trustedKeys"),
 		}
 
 		rlsmgrconfig.OptionsConfig.Install = &config.InstallConfig{
@@ -68,10 +79,13 @@ release, you should use the helm delete --purge to delete it first.`,
 			failAuth(cmd)
 		}
 	},
+	Run: backendRun(importRun),
 }
 
 func init() { // nolint: dupl
 	values = map[string]string{}
+	importCmd.PersistentFlags().BoolVarP(&allowUnsigned, "allow-unsigned", "", false, "Import stored releases whose checksum manifest isn't signed by a trusted key, e.g. releases exported without a signing key")
+	importCmd.PersistentFlags().BoolVarP(&allowUnverified, "allow-unverified", "", false, "Import stored releases that don't match the checksum manifest, or that have no manifest")
 	importCmd.PersistentFlags().BoolVarP(&force, "force", "", false, "Skip safety checks")
 	importCmd.PersistentFlags().BoolVarP(&wait, "wait", "", false, "if set, will wait until all Pods, PVCs, Services, and minimum number of Pods of a Deployment, StatefulSet, or ReplicaSet are in a ready state before marking the release as successful")
 	importCmd.PersistentFlags().BoolVarP(&replace, "replace", "", false, "re-use the given name, only if that name is a deleted release which remains in the history. This is unsafe in production")
@@ -83,9 +97,12 @@ func init() { // nolint: dupl
 	importCmd.PersistentFlags().StringVarP(&target, "target-namespace", "", "", "Specify a new namespace to import releases to")
 	importCmd.PersistentFlags().StringToStringVarP(&values, "update-values", "", map[string]string{}, "Specify a mapping of values to update when importing releases. Overrides apply to all releases for which a given value is already set, but will not insert the value if it doesn't already exist")
 	importCmd.PersistentFlags().StringSliceP("exclude-namespaces", "", []string{}, "A list of namespaces to exclude. The default behavior is to import all namespaces")
+	importCmd.PersistentFlags().StringSliceVarP(&trustedKeyFiles, "trusted-keys", "", []string{}, "Files containing the PEM encoded ed25519 public keys trusted to sign the checksum manifest")
 	importCmd.PersistentFlags().IntVarP(&threads, "threads", "", 50, "The maximum number of threads to use for installing releases")
 
 	err := bindConfigFlags(importCmd, map[string]string{
+		"allowUnsigned":     "allow-unsigned",
+		"allowUnverified":   "allow-unverified",
 		"atomic":            "atomic",
 		"createNamespace":   "create-namespace",
 		"excludeNamespaces": "exclude-namespaces",
@@ -96,6 +113,7 @@ func init() { // nolint: dupl
 		"replace":           "replace",
 		"target":            "target-namespace",
 		"threads":           "threads",
+		"trustedKeys":       "trusted-keys",
 		"valueUpdates":      "update-values",
 		"wait":              "wait",
 	})
@@ -112,7 +130,12 @@ func importRun(cmd *cobra.Command, args []string) { // nolint: dupl
 		log.Fatalf("Failed to create Release Manager import: %v", err)
 	}
 
-	err = importt.Run()
+	importt.TrustedKeys, err = state.LoadTrustedKeys(rlsmgrconfig.Import.TrustedKeyFiles)
+	if err != nil {
+		log.Fatalf("Failed to load trusted keys: %v", err)
+	}
+
+	err = importt.Run(commandContext())
 	if err != nil {
 		log.Errorf("%v", err)
 	}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
+	"github.com/logicmonitor/k8s-release-manager/pkg/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var backendKubeConfig string
+var backendKubeContext string
+var backendNamespace string
+var objectKind string
+
+func kubernetesPreRun(cmd *cobra.Command) {
+	kubernetesOpts := &backend.KubernetesOpts{
+		Kind:        viper.GetString("backendObjectKind"),
+		KubeConfig:  viper.GetString("backendKubeconfig"),
+		KubeContext: viper.GetString("backendKubecontext"),
+		Namespace:   viper.GetString("backendNamespace"),
+	}
+
+	valid := validateKubernetesConfig(kubernetesOpts)
+	if !valid {
+		failAuth(cmd)
+	}
+
+	mgrstate = &state.State{
+		Backend: decorateBackend(&backend.Kubernetes{
+			BackendConfig: rlsmgrconfig.Backend,
+			Opts:          kubernetesOpts,
+		}),
+		Config: rlsmgrconfig,
+	}
+
+	err := mgrstate.Backend.Init(commandContext())
+	if err != nil {
+		log.Fatalf("Failed to initialize the Kubernetes backend: %v", err)
+	}
+
+	err = mgrstate.Init()
+	if err != nil {
+		log.Fatalf("Failed to initialize state: %v", err)
+	}
+}
+
+var kubernetesExportCmd = &cobra.Command{ // nolint: dupl
+	Use:   "kubernetes",
+	Short: "Export state using the Kubernetes backend",
+	Long: `Export state using the Kubernetes backend
+Each stored file is written as one or more Secrets or ConfigMaps in a
+namespace of the backend cluster, e.g. a central management cluster.
+Run: ` + RootCmd.Name() + ` export --help for more information about exporting`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		exportCmd.PreRun(cmd, args)
+		kubernetesPreRun(cmd)
+	},
+	Run: exportRun,
+}
+
+var kubernetesClearCmd = &cobra.Command{ // nolint: dupl
+	Use:   "kubernetes",
+	Short: "Clear state from the Kubernetes backend",
+	Long: `Clear state from the Kubernetes backend
+Run: ` + RootCmd.Name() + ` clear --help for more information about clearing
+state`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		clearCmd.PreRun(cmd, args)
+		kubernetesPreRun(cmd)
+	},
+	Run: clearRun,
+}
+
+var kubernetesMigrateCmd = &cobra.Command{ // nolint: dupl
+	Use:   "kubernetes",
+	Short: "Migrate state from the Kubernetes backend",
+	Long: `Migrate state from the Kubernetes backend
+Run: ` + RootCmd.Name() + ` migrate --help for more information about migrating
+state`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		migrateCmd.PreRun(cmd, args)
+		kubernetesPreRun(cmd)
+	},
+	Run: migrateRun,
+}
+
+var kubernetesImportCmd = &cobra.Command{ // nolint: dupl
+	Use:   "kubernetes",
+	Short: "Import state from the Kubernetes backend",
+	Long: `Import state from the Kubernetes backend
+Run: ` + RootCmd.Name() + ` import --help for more information about importing`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		importCmd.PreRun(cmd, args)
+		kubernetesPreRun(cmd)
+	},
+	Run: importRun,
+}
+
+func kubernetesFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVarP(&backendKubeConfig, "backendKubeconfig", "", "", "Use this kubeconfig path for the backend cluster, otherwise use the environment variable KUBECONFIG or ~/.kube/config")
+	cmd.PersistentFlags().StringVarP(&backendKubeContext, "backendKubecontext", "", "", "Use this kube context for the backend cluster, otherwise use the default")
+	cmd.PersistentFlags().StringVarP(&backendNamespace, "backendNamespace", "", "", "Required. Use this namespace in the backend cluster for backend storage")
+	cmd.PersistentFlags().StringVarP(&objectKind, "objectKind", "", backend.KubernetesKindSecret, "The kind of object used to store files, either 'secret' or 'configmap'")
+	err := bindConfigFlags(cmd, map[string]string{
+		"backendKubeconfig":  "backendKubeconfig",
+		"backendKubecontext": "backendKubecontext",
+		"backendNamespace":   "backendNamespace",
+		"backendObjectKind":  "objectKind",
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	kubernetesFlags(kubernetesClearCmd)
+	kubernetesFlags(kubernetesExportCmd)
+	kubernetesFlags(kubernetesImportCmd)
+	kubernetesFlags(kubernetesMigrateCmd)
+	exportCmd.AddCommand(kubernetesExportCmd)
+	importCmd.AddCommand(kubernetesImportCmd)
+	clearCmd.AddCommand(kubernetesClearCmd)
+	migrateCmd.AddCommand(kubernetesMigrateCmd)
+}
@@ -8,20 +8,33 @@ import (
 	"github.com/logicmonitor/k8s-release-manager/pkg/state"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
+var localDirMode string
+var localFileMode string
+
 func localPreRun(cmd *cobra.Command) {
-	localOpts := &backend.LocalOpts{}
+	dirMode, validDir := parseFileMode("dirMode", viper.GetString("localDirMode"))
+	fileMode, validFile := parseFileMode("fileMode", viper.GetString("localFileMode"))
+	if !validDir || !validFile {
+		failAuth(cmd)
+	}
+
+	localOpts := &backend.LocalOpts{
+		DirMode:  dirMode,
+		FileMode: fileMode,
+	}
 
 	mgrstate = &state.State{
-		Backend: &backend.Local{
+		Backend: decorateBackend(&backend.Local{
 			BackendConfig: rlsmgrconfig.Backend,
 			Opts:          localOpts,
-		},
+		}),
 		Config: rlsmgrconfig,
 	}
 
-	err := mgrstate.Backend.Init()
+	err := mgrstate.Backend.Init(commandContext())
 	if err != nil {
 		log.Fatalf("Failed to initialize the local backend: %v", err)
 	}
@@ -57,6 +70,19 @@ state`,
 	Run: clearRun,
 }
 
+var localMigrateCmd = &cobra.Command{ // nolint: dupl
+	Use:   "local",
+	Short: "Migrate state from the local backend",
+	Long: `Migrate state from the local backend
+Run: ` + RootCmd.Name() + ` migrate --help for more information about migrating
+state`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		migrateCmd.PreRun(cmd, args)
+		localPreRun(cmd)
+	},
+	Run: migrateRun,
+}
+
 var localImportCmd = &cobra.Command{ // nolint: dupl
 	Use:   "local",
 	Short: "Import state from the local backend",
@@ -70,7 +96,12 @@ Run: ` + RootCmd.Name() + ` import --help for more information about importing`,
 }
 
 func localFlags(cmd *cobra.Command) {
-	err := bindConfigFlags(cmd, map[string]string{})
+	cmd.PersistentFlags().StringVarP(&localDirMode, "dirMode", "", fmt.Sprintf("%04o", backend.DefaultLocalDirMode), "The octal permissions of the storage directory if it is created")
+	cmd.PersistentFlags().StringVarP(&localFileMode, "fileMode", "", fmt.Sprintf("%04o", backend.DefaultLocalFileMode), "The octal permissions of stored files")
+	err := bindConfigFlags(cmd, map[string]string{
+		"localDirMode":  "dirMode",
+		"localFileMode": "fileMode",
+	})
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -81,7 +112,9 @@ func init() {
 	localFlags(localClearCmd)
 	localFlags(localExportCmd)
 	localFlags(localImportCmd)
+	localFlags(localMigrateCmd)
 	exportCmd.AddCommand(localExportCmd)
 	importCmd.AddCommand(localImportCmd)
 	clearCmd.AddCommand(localClearCmd)
+	migrateCmd.AddCommand(localMigrateCmd)
 }
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+	"github.com/logicmonitor/k8s-release-manager/pkg/migrate"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var deleteSource bool
+var destination string
+var resume bool
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrate stored state to another backend",
+	Long: `
+Release Manager Migrate will copy every stored release and the Release
+Manager state from the configured backend to the --destination backend, e.g.
+file:///mnt/releases or s3://bucket/path?region=us-west-2. The destination
+URL accepts the same schemes and options as --backend.
+
+Files are copied as they are stored, i.e. still encrypted or compressed, and
+each copy is read back and verified against the source. Migrate fails if the
+destination already contains stored files unless --resume is set, in which
+case files that were already copied are skipped. Source files are only
+removed with --delete-source, once every file has been verified, and each
+only after its copy is checked again. The destination must not be the same
+location as the source.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		valid := validateCommonConfig()
+		if !valid {
+			failAuth(cmd)
+		}
+
+		rlsmgrconfig.Migrate = &config.MigrateConfig{
+			DeleteSource: viper.GetBool("deleteSource"),
+			Destination:  viper.GetString("destination"),
+			Resume:       viper.GetBool("resume"),
+		}
+
+		valid = validateMigrateConfig()
+		if !valid {
+			failAuth(cmd)
+		}
+	},
+	Run: backendRun(migrateRun),
+}
+
+func init() { // nolint: dupl
+	migrateCmd.PersistentFlags().StringVarP(&destination, "destination", "", "", "Required. The URL of the destination backend and path, e.g. file:///mnt/releases or s3://bucket/path?region=us-west-2")
+	migrateCmd.PersistentFlags().BoolVarP(&deleteSource, "delete-source", "", false, "Remove the source files once every file has been copied and verified")
+	migrateCmd.PersistentFlags().BoolVarP(&resume, "resume", "", false, "Continue a previous migration, skipping files that were already copied")
+	err := bindConfigFlags(migrateCmd, map[string]string{
+		"deleteSource": "delete-source",
+		"destination":  "destination",
+		"resume":       "resume",
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	RootCmd.AddCommand(migrateCmd)
+}
+
+func migrateRun(cmd *cobra.Command, args []string) { // nolint: dupl
+	dest, err := destinationBackend(rlsmgrconfig.Migrate.Destination)
+	if err != nil {
+		log.Fatalf("Failed to create the destination backend: %v", err)
+	}
+
+	err = dest.Init(commandContext())
+	if err != nil {
+		log.Fatalf("Failed to initialize the destination backend: %v", err)
+	}
+
+	migrate, err := migrate.New(rlsmgrconfig, storedBackend, dest)
+	if err != nil {
+		log.Fatalf("Failed to create Release Manager migrator: %v", err)
+	}
+
+	err = migrate.Run(commandContext())
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+}
+
+// destinationBackend returns the backend for the destination URL. The
+// destination shares the source's backend options, e.g. its timeout.
+func destinationBackend(destination string) (backend.Backend, error) {
+	cfg := *rlsmgrconfig.Backend
+	cfg.URL = destination
+	b, err := backend.FromURL(destination, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Trim(cfg.StoragePath, "/") == "" {
+		return nil, fmt.Errorf("The destination %s must include a path", destination)
+	}
+	return retrying(b), nil
+}
@@ -1,9 +1,16 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
 	"github.com/logicmonitor/k8s-release-manager/pkg/config"
 	"github.com/logicmonitor/k8s-release-manager/pkg/constants"
 	log "github.com/sirupsen/logrus"
@@ -12,6 +19,15 @@ import (
 )
 
 var rlsmgrconfig *config.Config
+var backendURL string
+var backendMaxAttempts int
+var backendRetryBackoffMs int
+var backendRetryMaxBackoffMs int
+var backendTimeoutSec int
+var cacheDir string
+var cacheMaxSizeMB int
+var cmdCtx context.Context
+var cmdCtxOnce sync.Once
 var cfgFile string
 var debug bool
 var dryRun bool
@@ -20,6 +36,14 @@ var kubeConfig string
 var kubeContext string
 var storagePath string
 var releaseName string
+var ageIdentityFile string
+var ageRecipients []string
+var allowUnencrypted bool
+var compression string
+var decryptionKeyFiles []string
+var encryptionKeyFile string
+var mirrorConsistency string
+var mirrorPaths []string
 
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
@@ -61,7 +85,36 @@ to the configured cluster and 'clear' requires no custer connection whatsoever.
 		rlsmgrconfig.DryRun = viper.GetBool("dryRun")
 		rlsmgrconfig.VerboseMode = viper.GetBool("verbose")
 		rlsmgrconfig.Backend = &config.BackendConfig{
+			Cache: &config.CacheConfig{
+				Dir:     viper.GetString("cacheDir"),
+				MaxSize: viper.GetInt64("cacheMaxSize") * 1024 * 1024,
+			},
+			Compression: viper.GetString("compression"),
+			Encryption: &config.EncryptionConfig{
+				AgeIdentityFile:    viper.GetString("ageIdentityFile"),
+				AgeRecipients:      viper.GetStringSlice("ageRecipients"),
+				AllowUnencrypted:   viper.GetBool("allowUnencrypted"),
+				DecryptionKeyFiles: viper.GetStringSlice("decryptionKeyFiles"),
+				KeyFile:            viper.GetString("encryptionKeyFile"),
+			},
+			Mirror: &config.MirrorConfig{
+				Consistency: viper.GetString("mirrorConsistency"),
+				Paths:       viper.GetStringSlice("mirrorPaths"),
+			},
+			Retry: &config.RetryConfig{
+				InitialBackoff: time.Duration(viper.GetInt64("backendRetryBackoff")) * time.Millisecond,
+				MaxAttempts:    viper.GetInt("backendMaxAttempts"),
+				MaxBackoff:     time.Duration(viper.GetInt64("backendRetryMaxBackoff")) * time.Millisecond,
+			},
 			StoragePath: viper.GetString("path"),
+			Timeout:     time.Duration(viper.GetInt64("backendTimeout")) * time.Second,
+			URL:         viper.GetString("backend"),
+		}
+
+		// backend subcommands configure the backend with their own flags
+		if rlsmgrconfig.Backend.URL != "" && cmd.HasParent() && cmd.Parent().HasParent() {
+			fmt.Printf("--backend can't be used with the %s subcommand\n", cmd.Name())
+			failAuth(cmd)
 		}
 
 		// check env for KUBECONFIG
@@ -104,13 +157,43 @@ func init() {
 	RootCmd.PersistentFlags().StringVarP(&kubeConfig, "kubeconfig", "", "", "Use this kubeconfig path, otherwise use the environment variable KUBECONFIG or ~/.kube/config")
 	RootCmd.PersistentFlags().StringVarP(&kubeContext, "kubecontext", "", "", "Use this kube context, otherwise use the default")
 	RootCmd.PersistentFlags().StringVarP(&storagePath, "path", "", "", "Required. Use this path within the backend for state storage")
+	RootCmd.PersistentFlags().StringVarP(&backendURL, "backend", "", "", fmt.Sprintf("Use the backend and path at this URL instead of a backend subcommand, e.g. s3://bucket/path?region=us-west-2 or file:///path. Supported schemes: %s", strings.Join(backend.Schemes(), ", ")))
+	RootCmd.PersistentFlags().IntVarP(&backendTimeoutSec, "backend-timeout", "", 120, "The time, in seconds, to wait for an individual backend operation. Set to 0 to wait indefinitely")
+	RootCmd.PersistentFlags().IntVarP(&backendMaxAttempts, "backend-max-attempts", "", 3, "The maximum number of attempts for a backend operation that fails with a transient error. Set to 1 to disable retries")
+	RootCmd.PersistentFlags().IntVarP(&backendRetryBackoffMs, "backend-retry-backoff", "", 500, "The maximum time, in milliseconds, to wait before the first retry of a backend operation. The wait doubles with each retry")
+	RootCmd.PersistentFlags().IntVarP(&backendRetryMaxBackoffMs, "backend-retry-max-backoff", "", 30000, "The maximum time, in milliseconds, to wait between retries of a backend operation")
+	RootCmd.PersistentFlags().StringVarP(&cacheDir, "cache-dir", "", "", "Cache files read from a remote backend in this directory and reuse them until they change")
+	RootCmd.PersistentFlags().IntVarP(&cacheMaxSizeMB, "cache-max-size", "", 512, "The maximum size, in MiB, of the files in --cache-dir. The least recently used files are evicted first")
+	RootCmd.PersistentFlags().StringVarP(&compression, "compression", "", backend.CompressionNone, "Compress stored files with this algorithm, one of 'none', 'gzip' or 'zstd'. Compressed files are always readable")
+	RootCmd.PersistentFlags().StringVarP(&encryptionKeyFile, "encryptionKeyFile", "", "", "Encrypt stored files with data keys wrapped by the base64 encoded 256-bit master key in this file")
+	RootCmd.PersistentFlags().StringSliceVarP(&decryptionKeyFiles, "decryptionKeyFiles", "", []string{}, "Additional master key files used only to decrypt stored files, e.g. keys that have been rotated out")
+	RootCmd.PersistentFlags().StringSliceVarP(&ageRecipients, "ageRecipients", "", []string{}, "Encrypt stored files with data keys wrapped for these age recipients")
+	RootCmd.PersistentFlags().StringVarP(&ageIdentityFile, "ageIdentityFile", "", "", "Decrypt stored files using the age identities in this file")
+	RootCmd.PersistentFlags().BoolVarP(&allowUnencrypted, "allow-unencrypted", "", false, "Read stored files that aren't encrypted while encryption is configured, e.g. to encrypt existing files with export --reencrypt")
+	RootCmd.PersistentFlags().StringSliceVarP(&mirrorPaths, "mirror-paths", "", []string{}, "Also write stored files to these local paths, e.g. an NFS share, or backend URLs, e.g. s3://bucket/path. Files are read from the configured backend unless it fails")
+	RootCmd.PersistentFlags().StringVarP(&mirrorConsistency, "mirror-consistency", "", backend.MirrorConsistencyAll, "Whether writes must succeed on 'all' mirror targets or on at least one, i.e. 'best-effort'")
 	err := bindConfigFlags(RootCmd, map[string]string{
-		"debug":       "debug",
-		"dryRun":      "dry-run",
-		"verbose":     "verbose",
-		"kubeconfig":  "kubeconfig",
-		"kubecontext": "kubecontext",
-		"path":        "path",
+		"ageIdentityFile":        "ageIdentityFile",
+		"ageRecipients":          "ageRecipients",
+		"allowUnencrypted":       "allow-unencrypted",
+		"backend":                "backend",
+		"backendMaxAttempts":     "backend-max-attempts",
+		"backendRetryBackoff":    "backend-retry-backoff",
+		"backendRetryMaxBackoff": "backend-retry-max-backoff",
+		"backendTimeout":         "backend-timeout",
+		"cacheDir":               "cache-dir",
+		"cacheMaxSize":           "cache-max-size",
+		"compression":            "compression",
+		"debug":                  "debug",
+		"decryptionKeyFiles":     "decryptionKeyFiles",
+		"dryRun":                 "dry-run",
+		"encryptionKeyFile":      "encryptionKeyFile",
+		"mirrorConsistency":      "mirror-consistency",
+		"mirrorPaths":            "mirror-paths",
+		"verbose":                "verbose",
+		"kubeconfig":             "kubeconfig",
+		"kubecontext":            "kubecontext",
+		"path":                   "path",
 	})
 	if err != nil {
 		fmt.Println(err)
@@ -118,6 +201,24 @@ func init() {
 	}
 }
 
+// commandContext returns the context for the current command, which is
+// cancelled when the process receives SIGINT or SIGTERM
+func commandContext() context.Context {
+	cmdCtxOnce.Do(func() {
+		var cancel context.CancelFunc
+		cmdCtx, cancel = context.WithCancel(context.Background())
+
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			sig := <-sigs
+			log.Warnf("Received %s. Cancelling in-flight operations", sig)
+			cancel()
+		}()
+	})
+	return cmdCtx
+}
+
 func bindConfigFlags(cmd *cobra.Command, mapping map[string]string) (err error) {
 	for k, v := range mapping {
 		err = viper.BindPFlag(k, cmd.PersistentFlags().Lookup(v))
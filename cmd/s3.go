@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
 	"github.com/logicmonitor/k8s-release-manager/pkg/state"
@@ -13,38 +14,83 @@ import (
 
 var accessKeyID string
 var bucket string
+var caBundle string
+var endpoint string
+var externalID string
+var forcePathStyle bool
+var insecureSkipVerify bool
+var objectLockMode string
+var objectLockRetentionDays int
+var profile string
 var region string
+var roleARN string
+var roleSessionName string
 var secretAccessKey string
 var sessionToken string
+var tagObjects bool
+var sse string
+var sseCustomerKey string
+var sseKMSEncryptionContext map[string]string
+var sseKMSKeyID string
+var storageClass string
+var webIdentityTokenFile string
 
 func s3PreRun(cmd *cobra.Command) {
 	s3Opts := &backend.S3Opts{
 		Auth: &backend.S3Auth{
-			AccessKeyID:     viper.GetString("accessKeyID"),
-			SecretAccessKey: viper.GetString("secretAccessKey"),
-			SessionToken:    viper.GetString("sessionToken"),
+			AccessKeyID:          viper.GetString("accessKeyID"),
+			ExternalID:           viper.GetString("s3ExternalID"),
+			Profile:              viper.GetString("s3Profile"),
+			RoleARN:              viper.GetString("s3RoleARN"),
+			RoleSessionName:      viper.GetString("s3RoleSessionName"),
+			SecretAccessKey:      viper.GetString("secretAccessKey"),
+			SessionToken:         viper.GetString("sessionToken"),
+			WebIdentityTokenFile: viper.GetString("s3WebIdentityTokenFile"),
 		},
 		Bucket: viper.GetString("bucket"),
+		Encryption: &backend.S3Encryption{
+			CustomerKey:          viper.GetString("sseCustomerKey"),
+			KMSEncryptionContext: viper.GetStringMapString("sseKMSEncryptionContext"),
+			KMSKeyID:             viper.GetString("sseKMSKeyID"),
+			ServerSideEncryption: viper.GetString("sse"),
+		},
+		Endpoint: &backend.S3Endpoint{
+			CABundle:           viper.GetString("s3CABundle"),
+			ForcePathStyle:     viper.GetBool("s3ForcePathStyle"),
+			InsecureSkipVerify: viper.GetBool("s3InsecureSkipVerify"),
+			URL:                viper.GetString("s3Endpoint"),
+		},
 		Region: viper.GetString("region"),
+		Retention: &backend.S3Retention{
+			Mode:   viper.GetString("s3ObjectLockMode"),
+			Period: time.Duration(viper.GetInt64("s3ObjectLockRetentionDays")) * 24 * time.Hour,
+		},
+		StorageClass: viper.GetString("s3StorageClass"),
+		Tagging:      viper.GetBool("s3TagObjects"),
 	}
 
-	valid := validateS3Auth(s3Opts) && validateS3Config(s3Opts)
+	valid := validateS3Auth(s3Opts) && validateS3Config(s3Opts) && validateS3Endpoint(s3Opts) && validateS3Encryption(s3Opts) && validateS3Retention(s3Opts)
 	if !valid {
 		failAuth(cmd)
 	}
 
 	mgrstate = &state.State{
-		Backend: &backend.S3{
+		Backend: decorateBackend(&backend.S3{
 			BackendConfig: rlsmgrconfig.Backend,
 			Opts:          s3Opts,
-		},
+		}),
 		Config: rlsmgrconfig,
 	}
-	err := mgrstate.Init()
+
+	err := mgrstate.Backend.Init(commandContext())
 	if err != nil {
-		log.Fatalf("Failed to initialize state: %v", err)
+		log.Fatalf("Failed to initialize the S3 backend: %v", err)
 	}
 
+	err = mgrstate.Init()
+	if err != nil {
+		log.Fatalf("Failed to initialize state: %v", err)
+	}
 }
 
 var s3ExportCmd = &cobra.Command{ // nolint: dupl
@@ -72,6 +118,19 @@ state`,
 	Run: clearRun,
 }
 
+var s3MigrateCmd = &cobra.Command{ // nolint: dupl
+	Use:   "s3",
+	Short: "Migrate state from the S3 backend",
+	Long: `Migrate state from the S3 backend
+Run: ` + RootCmd.Name() + ` migrate --help for more information about migrating
+state`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		migrateCmd.PreRun(cmd, args)
+		s3PreRun(cmd)
+	},
+	Run: migrateRun,
+}
+
 var s3ImportCmd = &cobra.Command{ // nolint: dupl
 	Use:   "s3",
 	Short: "Import state from the S3 backend",
@@ -87,15 +146,49 @@ Run: ` + RootCmd.Name() + ` import --help for more information about importing`,
 func s3Flags(cmd *cobra.Command) {
 	cmd.PersistentFlags().StringVarP(&accessKeyID, "accessKeyID", "", "", "An AWS Access Key ID for accessing the S3 bucket, otherwise use the default AWS credential provider chain")
 	cmd.PersistentFlags().StringVarP(&bucket, "bucket", "", "", "Required. Use this S3 bucket for backend storage")
+	cmd.PersistentFlags().StringVarP(&caBundle, "caBundle", "", "", "A PEM encoded CA bundle used to verify the S3 endpoint's certificate in addition to the system roots")
+	cmd.PersistentFlags().StringVarP(&endpoint, "endpoint", "", "", "A custom S3-compatible endpoint URL, e.g. https://minio.example.com:9000, otherwise use AWS")
+	cmd.PersistentFlags().StringVarP(&externalID, "external-id", "", "", "The external ID required to assume --role-arn, if any")
+	cmd.PersistentFlags().BoolVarP(&forcePathStyle, "forcePathStyle", "", false, "Use path-style addressing (https://endpoint/bucket/key) instead of virtual-hosted-style, as required by most S3-compatible stores")
+	cmd.PersistentFlags().BoolVarP(&insecureSkipVerify, "insecureSkipVerify", "", false, "Skip verification of the S3 endpoint's TLS certificate. This is insecure and intended for testing only")
+	cmd.PersistentFlags().StringVarP(&objectLockMode, "objectLockMode", "", "", "Protect uploaded releases with this S3 Object Lock retention mode, either GOVERNANCE or COMPLIANCE. The bucket must have Object Lock enabled")
+	cmd.PersistentFlags().IntVarP(&objectLockRetentionDays, "objectLockRetentionDays", "", 0, "The number of days uploaded releases are protected by --objectLockMode")
+	cmd.PersistentFlags().StringVarP(&profile, "profile", "", "", "Use this named profile from the shared AWS config and credentials files")
 	cmd.PersistentFlags().StringVarP(&region, "region", "", "us-east-1", "The backend S3 bucket's region")
+	cmd.PersistentFlags().StringVarP(&roleARN, "role-arn", "", "", "Assume this IAM role, e.g. a cross-account backup role, to access the S3 bucket. Its credentials are refreshed before they expire")
+	cmd.PersistentFlags().StringVarP(&roleSessionName, "role-session-name", "", "", "The session name used when assuming --role-arn. The default is 'releasemanager'")
 	cmd.PersistentFlags().StringVarP(&secretAccessKey, "secretAccessKey", "", "", "An AWS Secret Access Key for accessing the S3 bucket, otherwise use the default AWS credential provider chain")
+	cmd.PersistentFlags().StringVarP(&sse, "sse", "", "", "The server-side encryption to apply to uploads, either AES256 (SSE-S3) or aws:kms (SSE-KMS)")
+	cmd.PersistentFlags().StringVarP(&sseCustomerKey, "sseCustomerKey", "", "", "A base64 encoded 256-bit key used to encrypt and decrypt objects with SSE-C")
+	cmd.PersistentFlags().StringToStringVarP(&sseKMSEncryptionContext, "sseKMSEncryptionContext", "", map[string]string{}, "The encryption context to use with SSE-KMS")
+	cmd.PersistentFlags().StringVarP(&sseKMSKeyID, "sseKMSKeyID", "", "", "The ID or ARN of the KMS key to use with SSE-KMS, otherwise use the AWS managed key")
 	cmd.PersistentFlags().StringVarP(&sessionToken, "sessionToken", "", "", "An AWS STS Session Token  for accessing the S3 bucket, otherwise use the default AWS credential provider chain")
+	cmd.PersistentFlags().StringVarP(&storageClass, "storageClass", "", "", "The storage class of uploaded releases, e.g. STANDARD_IA, otherwise the bucket's default. Archive classes must be restored before importing")
+	cmd.PersistentFlags().BoolVarP(&tagObjects, "tagObjects", "", false, "Also attach the stored releases' metadata, e.g. cluster, namespace and chart, as object tags. Requires the s3:PutObjectTagging permission")
+	cmd.PersistentFlags().StringVarP(&webIdentityTokenFile, "web-identity-token-file", "", "", "Assume --role-arn with the OIDC token in this file, e.g. a projected service account token, instead of other credentials")
 	err := bindConfigFlags(cmd, map[string]string{
-		"accessKeyID":     "accessKeyID",
-		"bucket":          "bucket",
-		"region":          "region",
-		"secretAccessKey": "secretAccessKey",
-		"sessionToken":    "sessionToken",
+		"accessKeyID":               "accessKeyID",
+		"bucket":                    "bucket",
+		"region":                    "region",
+		"s3CABundle":                "caBundle",
+		"s3Endpoint":                "endpoint",
+		"s3ExternalID":              "external-id",
+		"s3ForcePathStyle":          "forcePathStyle",
+		"s3InsecureSkipVerify":      "insecureSkipVerify",
+		"s3ObjectLockMode":          "objectLockMode",
+		"s3ObjectLockRetentionDays": "objectLockRetentionDays",
+		"s3Profile":                 "profile",
+		"s3RoleARN":                 "role-arn",
+		"s3RoleSessionName":         "role-session-name",
+		"s3StorageClass":            "storageClass",
+		"s3TagObjects":              "tagObjects",
+		"s3WebIdentityTokenFile":    "web-identity-token-file",
+		"secretAccessKey":           "secretAccessKey",
+		"sessionToken":              "sessionToken",
+		"sse":                       "sse",
+		"sseCustomerKey":            "sseCustomerKey",
+		"sseKMSEncryptionContext":   "sseKMSEncryptionContext",
+		"sseKMSKeyID":               "sseKMSKeyID",
 	})
 	if err != nil {
 		fmt.Println(err)
@@ -107,7 +200,9 @@ func init() {
 	s3Flags(s3ClearCmd)
 	s3Flags(s3ExportCmd)
 	s3Flags(s3ImportCmd)
+	s3Flags(s3MigrateCmd)
 	exportCmd.AddCommand(s3ExportCmd)
 	importCmd.AddCommand(s3ImportCmd)
 	clearCmd.AddCommand(s3ClearCmd)
+	migrateCmd.AddCommand(s3MigrateCmd)
 }
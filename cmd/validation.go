@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
 	"github.com/spf13/cobra"
 )
@@ -18,13 +23,60 @@ func failAuth(cmd *cobra.Command) {
 
 func validateCommonConfig() bool {
 	valid := true
-	if rlsmgrconfig.Backend.StoragePath == "" {
+	switch {
+	case rlsmgrconfig.Backend.URL != "" && rlsmgrconfig.Backend.StoragePath != "":
+		fmt.Println("The flags --backend and --path are mutually exclusive. Include the path in the --backend URL")
+		valid = false
+	case rlsmgrconfig.Backend.URL == "" && rlsmgrconfig.Backend.StoragePath == "":
 		fmt.Println("You must specify --path")
 		valid = false
 	}
+	if rlsmgrconfig.Backend.Encryption.KeyFile != "" && len(rlsmgrconfig.Backend.Encryption.AgeRecipients) > 0 {
+		fmt.Println("The flags --encryptionKeyFile and --ageRecipients are mutually exclusive")
+		valid = false
+	}
+	if rlsmgrconfig.Backend.Retry.MaxAttempts < 1 {
+		fmt.Println("--backend-max-attempts must be at least 1")
+		valid = false
+	}
+	if rlsmgrconfig.Backend.Retry.InitialBackoff < 0 || rlsmgrconfig.Backend.Retry.MaxBackoff < rlsmgrconfig.Backend.Retry.InitialBackoff {
+		fmt.Println("--backend-retry-max-backoff must be at least --backend-retry-backoff")
+		valid = false
+	}
+	if rlsmgrconfig.Backend.Cache.Dir != "" && rlsmgrconfig.Backend.Cache.MaxSize <= 0 {
+		fmt.Println("--cache-max-size must be greater than 0")
+		valid = false
+	}
+	switch rlsmgrconfig.Backend.Mirror.Consistency {
+	case backend.MirrorConsistencyAll, backend.MirrorConsistencyBestEffort:
+	default:
+		fmt.Printf("--mirror-consistency must be one of %s or %s\n", backend.MirrorConsistencyAll, backend.MirrorConsistencyBestEffort)
+		valid = false
+	}
+	switch rlsmgrconfig.Backend.Compression {
+	case backend.CompressionNone, backend.CompressionGzip, backend.CompressionZstd:
+	default:
+		fmt.Printf("--compression must be one of %s, %s or %s\n", backend.CompressionNone, backend.CompressionGzip, backend.CompressionZstd)
+		valid = false
+	}
 	return valid
 }
 
+// export writes files, so it needs a key to encrypt them with, not only keys
+// to decrypt them
+func validateExportConfig() bool {
+	enc := rlsmgrconfig.Backend.Encryption
+	if enc.Enabled() && enc.KeyFile == "" && len(enc.AgeRecipients) == 0 {
+		fmt.Println("Export requires --encryptionKeyFile or --ageRecipients when --decryptionKeyFiles or --ageIdentityFile is set")
+		return false
+	}
+	if rlsmgrconfig.Export.LeaseDuration <= 0 {
+		fmt.Println("You must specify a positive --lease-duration")
+		return false
+	}
+	return true
+}
+
 func validateImportConfig() bool {
 	valid := true
 	if rlsmgrconfig.Import.Target != "" && rlsmgrconfig.Import.Namespace == "" {
@@ -41,6 +93,14 @@ func validateImportConfig() bool {
 	return valid
 }
 
+func validateMigrateConfig() bool {
+	if rlsmgrconfig.Migrate.Destination == "" {
+		fmt.Println("You must specify --destination")
+		return false
+	}
+	return true
+}
+
 func validateS3Config(opts *backend.S3Opts) bool {
 	valid := true
 	if opts.Bucket == "" {
@@ -54,13 +114,106 @@ func validateS3Config(opts *backend.S3Opts) bool {
 	return valid
 }
 
+func validateS3Endpoint(opts *backend.S3Opts) bool {
+	if opts.Endpoint.CABundle != "" && opts.Endpoint.InsecureSkipVerify {
+		fmt.Println("The flags --caBundle and --insecureSkipVerify are mutually exclusive")
+		return false
+	}
+	if opts.Endpoint.URL != "" {
+		u, err := url.Parse(opts.Endpoint.URL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			fmt.Println("--endpoint must be an absolute URL, e.g. https://minio.example.com:9000")
+			return false
+		}
+	}
+	return true
+}
+
+func validateS3Encryption(opts *backend.S3Opts) bool {
+	enc := opts.Encryption
+	valid := true
+	switch enc.ServerSideEncryption {
+	case "", s3.ServerSideEncryptionAes256, s3.ServerSideEncryptionAwsKms:
+	default:
+		fmt.Printf("--sse must be one of %s or %s\n", s3.ServerSideEncryptionAes256, s3.ServerSideEncryptionAwsKms)
+		valid = false
+	}
+
+	if enc.ServerSideEncryption != s3.ServerSideEncryptionAwsKms && (enc.KMSKeyID != "" || len(enc.KMSEncryptionContext) > 0) {
+		fmt.Printf("--sseKMSKeyID and --sseKMSEncryptionContext require --sse %s\n", s3.ServerSideEncryptionAwsKms)
+		valid = false
+	}
+
+	if enc.CustomerKey == "" {
+		return valid
+	}
+
+	if enc.ServerSideEncryption != "" {
+		fmt.Println("The flags --sse and --sseCustomerKey are mutually exclusive")
+		valid = false
+	}
+
+	key, err := base64.StdEncoding.DecodeString(enc.CustomerKey)
+	if err != nil || len(key) != 32 {
+		fmt.Println("--sseCustomerKey must be a base64 encoded 256-bit key")
+		valid = false
+	}
+
+	// S3 rejects SSE-C requests over plain http
+	if strings.HasPrefix(opts.Endpoint.URL, "http://") {
+		fmt.Println("--sseCustomerKey requires an https --endpoint")
+		valid = false
+	}
+	return valid
+}
+
 func validateS3Auth(opts *backend.S3Opts) bool {
-	if !validateS3SessionToken(opts) || !validateS3Tokens(opts) {
+	if !validateS3SessionToken(opts) || !validateS3Tokens(opts) || !validateS3Role(opts) {
 		return false
 	}
 	return true
 }
 
+func validateS3Retention(opts *backend.S3Opts) bool {
+	valid := true
+	if opts.StorageClass != "" && !contains(s3.StorageClass_Values(), opts.StorageClass) {
+		fmt.Printf("--storageClass must be one of %s\n", strings.Join(s3.StorageClass_Values(), ", "))
+		valid = false
+	}
+	switch {
+	case opts.Retention.Mode == "" && opts.Retention.Period == 0:
+	case !contains(s3.ObjectLockMode_Values(), opts.Retention.Mode):
+		fmt.Printf("--objectLockMode must be one of %s\n", strings.Join(s3.ObjectLockMode_Values(), ", "))
+		valid = false
+	case opts.Retention.Period <= 0:
+		fmt.Println("--objectLockMode requires a positive --objectLockRetentionDays")
+		valid = false
+	}
+	return valid
+}
+
+func validateS3Role(opts *backend.S3Opts) bool {
+	valid := true
+	if opts.Auth.RoleARN == "" && (opts.Auth.ExternalID != "" || opts.Auth.RoleSessionName != "" || opts.Auth.WebIdentityTokenFile != "") {
+		fmt.Println("The flags --external-id, --role-session-name and --web-identity-token-file require --role-arn")
+		valid = false
+	}
+	if opts.Auth.Profile != "" && opts.Auth.AccessKeyID != "" {
+		fmt.Println("The flags --profile and --accessKeyID are mutually exclusive")
+		valid = false
+	}
+	if opts.Auth.WebIdentityTokenFile != "" && (opts.Auth.Profile != "" || opts.Auth.AccessKeyID != "") {
+		fmt.Println("The flag --web-identity-token-file is mutually exclusive with --profile and --accessKeyID")
+		valid = false
+	}
+	if opts.Auth.WebIdentityTokenFile != "" && opts.Auth.ExternalID != "" {
+		// AssumeRoleWithWebIdentity doesn't accept an external ID
+		fmt.Println("The flags --external-id and --web-identity-token-file are mutually exclusive")
+		valid = false
+	}
+	return valid
+}
+
 func validateS3Tokens(opts *backend.S3Opts) bool {
 	if (opts.Auth.AccessKeyID != "" && opts.Auth.SecretAccessKey == "") || (opts.Auth.AccessKeyID == "" && opts.Auth.SecretAccessKey != "") {
 		fmt.Println("You must specify both --accessKeyID and --secretAccessKey or neither")
@@ -76,3 +229,72 @@ func validateS3SessionToken(opts *backend.S3Opts) bool {
 	}
 	return true
 }
+
+func validateGCSConfig(opts *backend.GCSOpts) bool {
+	if opts.Bucket == "" {
+		fmt.Println("You must specify --bucket")
+		return false
+	}
+	return true
+}
+
+func validateGCSAuth(opts *backend.GCSOpts) bool {
+	if opts.Auth.Anonymous && opts.Auth.CredentialsFile != "" {
+		fmt.Println("The flags --anonymous and --credentialsFile are mutually exclusive")
+		return false
+	}
+	return true
+}
+
+func validateAzureConfig(opts *backend.AzureOpts) bool {
+	valid := true
+	if opts.Account == "" {
+		fmt.Println("You must specify --account")
+		valid = false
+	}
+	if opts.Container == "" {
+		fmt.Println("You must specify --container")
+		valid = false
+	}
+	return valid
+}
+
+func validateAzureAuth(opts *backend.AzureOpts) bool {
+	if (opts.Auth.AccountKey == "") == (opts.Auth.SASToken == "") {
+		fmt.Println("You must specify exactly one of --accountKey or --sasToken")
+		return false
+	}
+	return true
+}
+
+func validateKubernetesConfig(opts *backend.KubernetesOpts) bool {
+	valid := true
+	if opts.Namespace == "" {
+		fmt.Println("You must specify --backendNamespace")
+		valid = false
+	}
+	if opts.Kind != backend.KubernetesKindSecret && opts.Kind != backend.KubernetesKindConfigMap {
+		fmt.Printf("--objectKind must be one of %s or %s\n", backend.KubernetesKindSecret, backend.KubernetesKindConfigMap)
+		valid = false
+	}
+	return valid
+}
+
+// parseFileMode parses the octal permissions of the specified flag
+func parseFileMode(flag string, value string) (os.FileMode, bool) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		fmt.Printf("--%s must be octal permissions, e.g. 0644\n", flag)
+		return 0, false
+	}
+	return os.FileMode(mode), true
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -3,11 +3,19 @@ module github.com/logicmonitor/k8s-release-manager
 go 1.14
 
 require (
+	cloud.google.com/go/storage v1.22.1
+	filippo.io/age v1.0.0
+	github.com/Azure/azure-storage-blob-go v0.15.0
 	github.com/aws/aws-sdk-go v1.34.9
 	github.com/containerd/containerd v1.6.6 // indirect
+	github.com/klauspost/compress v1.13.6
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/cobra v1.4.0
 	github.com/spf13/viper v1.8.1
+	google.golang.org/api v0.74.0
 	gopkg.in/yaml.v2 v2.4.0
 	helm.sh/helm/v3 v3.9.0
+	k8s.io/api v0.24.0
+	k8s.io/apimachinery v0.24.0
+	k8s.io/client-go v0.24.0
 )
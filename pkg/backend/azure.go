@@ -0,0 +1,206 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+	"github.com/logicmonitor/k8s-release-manager/pkg/metrics"
+)
+
+const (
+	azureEndpointFormat = "https://%s.blob.core.windows.net"
+
+	azureEnvAccount    = "AZURE_STORAGE_ACCOUNT"
+	azureEnvAccountKey = "AZURE_STORAGE_KEY"
+	azureEnvSASToken   = "AZURE_STORAGE_SAS_TOKEN"
+)
+
+// Azure implements the Backend interface
+type Azure struct {
+	BackendConfig *config.BackendConfig
+	Opts          *AzureOpts
+	container     azblob.ContainerURL
+}
+
+// AzureOpts represents the Azure Blob Storage backend configuration options
+type AzureOpts struct {
+	Account   string
+	Auth      *AzureAuth
+	Container string
+	Endpoint  string
+}
+
+// AzureAuth represents the Azure Blob Storage backend authentication configuration options
+type AzureAuth struct {
+	AccountKey string
+	SASToken   string
+}
+
+func init() {
+	Register("azblob", newAzureFromURL)
+}
+
+// newAzureFromURL returns the Azure backend for azblob://container/path. The
+// query sets the account and endpoint options. The account and its
+// credentials default to $AZURE_STORAGE_ACCOUNT and $AZURE_STORAGE_KEY or
+// $AZURE_STORAGE_SAS_TOKEN.
+func newAzureFromURL(u *url.URL, cfg *config.BackendConfig) (Backend, error) {
+	err := requireHost(u, "container")
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+	opts := &AzureOpts{
+		Account: q.Get("account"),
+		Auth: &AzureAuth{
+			AccountKey: os.Getenv(azureEnvAccountKey),
+			SASToken:   os.Getenv(azureEnvSASToken),
+		},
+		Container: u.Host,
+		Endpoint:  q.Get("endpoint"),
+	}
+	if opts.Account == "" {
+		opts.Account = os.Getenv(azureEnvAccount)
+	}
+	if opts.Account == "" {
+		return nil, fmt.Errorf("The azblob backend URL must include the account, e.g. azblob://<container>/path?account=<account>")
+	}
+	if (opts.Auth.AccountKey == "") == (opts.Auth.SASToken == "") {
+		return nil, fmt.Errorf("Exactly one of $%s or $%s must be set", azureEnvAccountKey, azureEnvSASToken)
+	}
+	return &Azure{
+		BackendConfig: cfg,
+		Opts:          opts,
+	}, nil
+}
+
+// Init the backend
+func (b *Azure) Init(ctx context.Context) error {
+	credential, err := b.credential()
+	if err != nil {
+		return b.checkError(err)
+	}
+
+	u, err := b.containerURL()
+	if err != nil {
+		return b.checkError(err)
+	}
+	b.container = azblob.NewContainerURL(*u, azblob.NewPipeline(credential, azblob.PipelineOptions{}))
+	return nil
+}
+
+// Read opens the specified file from the backend for reading
+func (b *Azure) Read(ctx context.Context, filename string) (io.ReadCloser, error) {
+	resp, err := b.blob(filename).Download(ctx, 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		return nil, b.checkError(err)
+	}
+
+	return resp.Body(azblob.RetryReaderOptions{}), nil
+}
+
+// Config returns the backend's config
+func (b *Azure) Config() *config.BackendConfig {
+	return b.BackendConfig
+}
+
+// Writes the contents to the specified path on the backend
+func (b *Azure) Write(ctx context.Context, filename string, data io.Reader) error {
+	_, err := azblob.UploadStreamToBlockBlob(ctx, data, b.blob(filename).ToBlockBlobURL(), azblob.UploadStreamToBlockBlobOptions{})
+	if err != nil {
+		return b.checkError(err)
+	}
+	return nil
+}
+
+// Delete deletes the specified file from the backend
+func (b *Azure) Delete(ctx context.Context, filename string) error {
+	_, err := b.blob(filename).Delete(ctx, azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{})
+	if err != nil {
+		return b.checkError(err)
+	}
+	return nil
+}
+
+// List lists all files in the specified path on the backend
+func (b *Azure) List(ctx context.Context) ([]string, error) {
+	objects, err := b.ListDetailed(ctx)
+	return names(objects), err
+}
+
+// ListDetailed lists all files in the specified path on the backend along
+// with their metadata
+func (b *Azure) ListDetailed(ctx context.Context) (ret []*ObjectInfo, err error) {
+	path := b.path("")
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		resp, err := b.container.ListBlobsHierarchySegment(ctx, marker, delimiter, azblob.ListBlobsSegmentOptions{
+			Prefix: path,
+		})
+		if err != nil {
+			return nil, b.checkError(err)
+		}
+
+		for _, blob := range resp.Segment.BlobItems {
+			info := &ObjectInfo{
+				// trim the leading path from the filename
+				Name:    strings.Replace(blob.Name, path, "", 1),
+				ModTime: blob.Properties.LastModified,
+				ETag:    strings.Trim(string(blob.Properties.Etag), `"`),
+			}
+			if blob.Properties.ContentLength != nil {
+				info.Size = *blob.Properties.ContentLength
+			}
+			ret = append(ret, info)
+		}
+		marker = resp.NextMarker
+	}
+	return ret, nil
+}
+
+func (b *Azure) blob(filename string) azblob.BlobURL {
+	return b.container.NewBlobURL(b.path(filename))
+}
+
+func (b *Azure) path(filename string) string {
+	return objectPath(b.BackendConfig.StoragePath, filename)
+}
+
+func (b *Azure) containerURL() (*url.URL, error) {
+	endpoint := b.Opts.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf(azureEndpointFormat, b.Opts.Account)
+	}
+
+	u, err := url.Parse(strings.TrimSuffix(endpoint, delimiter) + delimiter + b.Opts.Container)
+	if err != nil {
+		return nil, err
+	}
+
+	// a SAS token is passed to the service as the URL's query string
+	if b.Opts.Auth.SASToken != "" {
+		u.RawQuery = strings.TrimPrefix(b.Opts.Auth.SASToken, "?")
+	}
+	return u, nil
+}
+
+func (b *Azure) credential() (azblob.Credential, error) {
+	if b.Opts.Auth.AccountKey != "" {
+		return azblob.NewSharedKeyCredential(b.Opts.Account, b.Opts.Auth.AccountKey)
+	}
+	return azblob.NewAnonymousCredential(), nil
+}
+
+func (b *Azure) checkError(err error) error {
+	metrics.AzureError()
+	if serr, ok := err.(azblob.StorageError); ok && serr.ServiceCode() == azblob.ServiceCodeContainerNotFound {
+		return fmt.Errorf("%s %s", azblob.ServiceCodeContainerNotFound, b.Opts.Container)
+	}
+	return err
+}
@@ -1,17 +1,133 @@
 package backend
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"strings"
+	"time"
 
 	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+	"github.com/logicmonitor/k8s-release-manager/pkg/constants"
+)
+
+const (
+	delimiter = "/"
 )
 
 // Backend is an interface that abstracts operations on a data store
 type Backend interface {
 	Config() *config.BackendConfig
-	Delete(filename string) error
-	Init() error
-	List() ([]string, error)
-	Read(filename string) ([]byte, error)
-	Write(filename string, data io.Reader) error
+	Delete(ctx context.Context, filename string) error
+	Init(ctx context.Context) error
+	List(ctx context.Context) ([]string, error)
+	ListDetailed(ctx context.Context) ([]*ObjectInfo, error)
+	Read(ctx context.Context, filename string) (io.ReadCloser, error)
+	Write(ctx context.Context, filename string, data io.Reader) error
+}
+
+// ConditionalWriter is implemented by backends that support optimistic
+// concurrency control, i.e. only replacing a file if it hasn't been modified
+// since it was read
+type ConditionalWriter interface {
+	// ReadVersion opens the specified file for reading and returns an opaque
+	// token identifying the version that was read
+	ReadVersion(ctx context.Context, filename string) (io.ReadCloser, string, error)
+	// WriteIfMatch writes the contents only if the stored file is still at the
+	// specified version, or if the version is empty, only if the file doesn't
+	// exist. It returns the version of the written file.
+	WriteIfMatch(ctx context.Context, filename string, data io.Reader, version string) (string, error)
+}
+
+var (
+	// ErrConflict is returned by conditional writes when the stored file
+	// doesn't match the expected version
+	ErrConflict = errors.New("the file was modified by another writer")
+	// ErrConditionalWriteUnsupported is returned by decorators when the
+	// wrapped backend doesn't implement ConditionalWriter
+	ErrConditionalWriteUnsupported = errors.New("the backend doesn't support conditional writes")
+	// ErrRetained is returned when a file can't be deleted because a
+	// retention policy, e.g. S3 Object Lock, protects it
+	ErrRetained = errors.New("the file is protected by a retention policy")
+)
+
+// RetentionError reports a file that can't be deleted until its retention
+// period ends, or until its legal hold is removed if RetainUntil is zero
+type RetentionError struct {
+	Filename    string
+	Mode        string
+	RetainUntil time.Time
+}
+
+func (e *RetentionError) Error() string {
+	if e.RetainUntil.IsZero() {
+		return fmt.Sprintf("%s is under a legal hold and can't be deleted", e.Filename)
+	}
+	return fmt.Sprintf("%s is retained in %s mode until %s and can't be deleted", e.Filename, e.Mode, e.RetainUntil.Format(time.RFC3339))
+}
+
+// Unwrap returns ErrRetained
+func (e *RetentionError) Unwrap() error {
+	return ErrRetained
+}
+
+// ObjectInfo represents the metadata of a stored file
+type ObjectInfo struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	// ETag is an opaque identifier that changes whenever the contents change
+	ETag string `json:"etag,omitempty"`
+	// SHA256 is the hex encoded digest of the stored contents, if known
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// names returns the names of the specified objects
+func names(objects []*ObjectInfo) (ret []string) {
+	for _, o := range objects {
+		ret = append(ret, o.Name)
+	}
+	return ret
+}
+
+// readCloser combines a Reader with the Close function of the underlying stream
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+// Close closes the underlying stream
+func (r *readCloser) Close() error {
+	return r.close()
+}
+
+// readAll reads the entire contents of the specified file from the backend
+func readAll(ctx context.Context, b Backend, filename string) ([]byte, error) {
+	r, err := b.Read(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close() // nolint: errcheck
+	return ioutil.ReadAll(r)
+}
+
+// isReleaseFile returns true for stored releases, as opposed to the manager's
+// state and lock files
+func isReleaseFile(filename string) bool {
+	return strings.HasSuffix(filename, "."+constants.ReleaseExtension)
+}
+
+// objectPath returns the object key for the specified file in an object store
+// by joining it to the storage path without a leading or trailing delimiter.
+// Only one delimiter is removed from each end, so keys written by earlier
+// releases, e.g. /<file> for a storage path of /, don't move.
+func objectPath(path string, filename string) string {
+	// remove leading /
+	path = strings.TrimPrefix(path, delimiter)
+
+	// remove trailing /
+	path = strings.TrimSuffix(path, delimiter)
+	return path + delimiter + filename
 }
@@ -0,0 +1,22 @@
+package backend
+
+import "testing"
+
+func TestObjectPath(t *testing.T) {
+	for _, tt := range []struct {
+		path string
+		want string
+	}{
+		{"releases", "releases/a.release"},
+		{"/releases/", "releases/a.release"},
+		{"/a/b", "a/b/a.release"},
+		{"/", "/a.release"},
+		{"//a/", "/a/a.release"},
+		{"a//", "a//a.release"},
+	} {
+		got := objectPath(tt.path, "a.release")
+		if got != tt.want {
+			t.Errorf("objectPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+// Package backendtest implements a conformance suite for implementations of
+// backend.Backend. Implementations run it from their tests, e.g.
+//
+//	func TestMemory(t *testing.T) {
+//		store := backend.NewMemoryStore()
+//		backendtest.TestBackend(t, func(path string) backend.Backend {
+//			return &backend.Memory{
+//				BackendConfig: &config.BackendConfig{StoragePath: path},
+//				Opts:          &backend.MemoryOpts{Store: store},
+//			}
+//		}, "releases", "/releases/")
+//	}
+package backendtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
+)
+
+const concurrentWriters = 16
+
+// TestBackend tests the backends returned by newBackend, which must return a
+// backend for the specified storage path. Backends for different paths must
+// share the same underlying store, e.g. the same bucket or filesystem. The
+// storage path must not be empty, and equivalentPaths are alternative spellings
+// of it, e.g. with leading or trailing delimiters, that must refer to the same
+// files. Each check runs as a subtest, in order, and files written by the
+// suite are deleted before it returns.
+//
+// The suite expects listed sizes to match the written contents, so it doesn't
+// apply to decorators such as backend.Compressed that list stored sizes.
+func TestBackend(t *testing.T, newBackend func(storagePath string) backend.Backend, path string, equivalentPaths ...string) {
+	s := &suite{ctx: context.Background()}
+
+	b := newBackend(path)
+	nested := newBackend(strings.TrimRight(path, "/") + "/nested")
+	sibling := newBackend(strings.TrimRight(path, "/") + "-sibling")
+	for _, x := range []backend.Backend{b, nested, sibling} {
+		err := x.Init(s.ctx)
+		if err != nil {
+			t.Fatalf("Init of %s: %v", x.Config().StoragePath, err)
+		}
+	}
+	defer s.cleanup()
+
+	t.Run("ReadMissing", func(t *testing.T) { s.testReadMissing(t, b) })
+	t.Run("ReadAfterWrite", func(t *testing.T) { s.testReadAfterWrite(t, b) })
+	t.Run("List", func(t *testing.T) { s.testList(t, b, nested, sibling) })
+	t.Run("EquivalentPaths", func(t *testing.T) { s.testEquivalentPaths(t, b, newBackend, equivalentPaths) })
+	t.Run("Delete", func(t *testing.T) { s.testDelete(t, b) })
+	t.Run("ConcurrentWrites", func(t *testing.T) { s.testConcurrentWrites(t, b) })
+	t.Run("ConditionalWrites", func(t *testing.T) { s.testConditionalWrites(t, b) })
+}
+
+type suite struct {
+	ctx context.Context
+	// the files written by each backend, deleted by cleanup
+	written map[backend.Backend]map[string]bool
+	mu      sync.Mutex
+}
+
+func (s *suite) write(b backend.Backend, filename string, data []byte) error {
+	s.mu.Lock()
+	if s.written == nil {
+		s.written = map[backend.Backend]map[string]bool{}
+	}
+	if s.written[b] == nil {
+		s.written[b] = map[string]bool{}
+	}
+	s.written[b][filename] = true
+	s.mu.Unlock()
+	return b.Write(s.ctx, filename, bytes.NewReader(data))
+}
+
+func (s *suite) read(b backend.Backend, filename string) ([]byte, error) {
+	r, err := b.Read(s.ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close() // nolint: errcheck
+	return ioutil.ReadAll(r)
+}
+
+// checkRead reports an error unless the file has the expected contents
+func (s *suite) checkRead(t *testing.T, b backend.Backend, filename string, want []byte) {
+	t.Helper()
+	got, err := s.read(b, filename)
+	switch {
+	case err != nil:
+		t.Errorf("%s: Read(%s): %v", b.Config().StoragePath, filename, err)
+	case !bytes.Equal(got, want):
+		t.Errorf("%s: Read(%s) = %q, want %q", b.Config().StoragePath, filename, got, want)
+	}
+}
+
+// checkList reports an error unless List and ListDetailed return exactly
+// the expected files
+func (s *suite) checkList(t *testing.T, b backend.Backend, want map[string][]byte) {
+	t.Helper()
+	var wantNames []string
+	for n := range want {
+		wantNames = append(wantNames, n)
+	}
+	sort.Strings(wantNames)
+
+	names, err := b.List(s.ctx)
+	if err != nil {
+		t.Errorf("%s: List: %v", b.Config().StoragePath, err)
+		return
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != strings.Join(wantNames, ",") {
+		t.Errorf("%s: List = %v, want %v", b.Config().StoragePath, names, wantNames)
+	}
+
+	objects, err := b.ListDetailed(s.ctx)
+	if err != nil {
+		t.Errorf("%s: ListDetailed: %v", b.Config().StoragePath, err)
+		return
+	}
+	if len(objects) != len(want) {
+		t.Errorf("%s: ListDetailed returned %d files, want %d", b.Config().StoragePath, len(objects), len(want))
+	}
+	for _, o := range objects {
+		data, ok := want[o.Name]
+		switch {
+		case !ok:
+			t.Errorf("%s: ListDetailed returned unexpected file %s", b.Config().StoragePath, o.Name)
+		case o.Size != int64(len(data)):
+			t.Errorf("%s: ListDetailed size of %s = %d, want %d", b.Config().StoragePath, o.Name, o.Size, len(data))
+		}
+	}
+}
+
+func (s *suite) testReadMissing(t *testing.T, b backend.Backend) {
+	_, err := s.read(b, "missing.release")
+	if err == nil {
+		t.Errorf("%s: Read of a missing file succeeded", b.Config().StoragePath)
+	}
+}
+
+func (s *suite) testReadAfterWrite(t *testing.T, b backend.Backend) {
+	for _, data := range [][]byte{[]byte("first"), []byte("overwritten"), {}} {
+		err := s.write(b, "a.release", data)
+		if err != nil {
+			t.Errorf("%s: Write(a.release): %v", b.Config().StoragePath, err)
+			return
+		}
+		s.checkRead(t, b, "a.release", data)
+	}
+
+	err := s.write(b, "a.release", []byte("a"))
+	if err != nil {
+		t.Errorf("%s: Write(a.release): %v", b.Config().StoragePath, err)
+	}
+}
+
+// testList checks that files in nested and sibling paths aren't listed
+func (s *suite) testList(t *testing.T, b backend.Backend, nested backend.Backend, sibling backend.Backend) {
+	for _, x := range []backend.Backend{nested, sibling} {
+		err := s.write(x, "other.release", []byte("other"))
+		if err != nil {
+			t.Errorf("%s: Write(other.release): %v", x.Config().StoragePath, err)
+		}
+	}
+
+	s.checkList(t, b, map[string][]byte{"a.release": []byte("a")})
+	s.checkList(t, nested, map[string][]byte{"other.release": []byte("other")})
+	s.checkRead(t, nested, "other.release", []byte("other"))
+}
+
+func (s *suite) testEquivalentPaths(t *testing.T, b backend.Backend, newBackend func(string) backend.Backend, paths []string) {
+	for _, p := range paths {
+		x := newBackend(p)
+		err := x.Init(s.ctx)
+		if err != nil {
+			t.Errorf("%s: Init: %v", p, err)
+			continue
+		}
+		s.checkRead(t, x, "a.release", []byte("a"))
+		s.checkList(t, x, map[string][]byte{"a.release": []byte("a")})
+	}
+}
+
+// TestDistinctPaths tests that the backends returned by newBackend for each of
+// the specified storage paths refer to different files, e.g. that only one
+// leading and trailing delimiter is removed from an object store's storage
+// path so that // and / remain different prefixes. Backends for different
+// paths must share the same underlying store.
+func TestDistinctPaths(t *testing.T, newBackend func(storagePath string) backend.Backend, paths ...string) {
+	s := &suite{ctx: context.Background()}
+	defer s.cleanup()
+
+	var backends []backend.Backend
+	for _, p := range paths {
+		b := newBackend(p)
+		err := b.Init(s.ctx)
+		if err != nil {
+			t.Fatalf("Init of %s: %v", p, err)
+		}
+		err = s.write(b, "distinct.release", []byte(p))
+		if err != nil {
+			t.Fatalf("%s: Write(distinct.release): %v", p, err)
+		}
+		backends = append(backends, b)
+	}
+
+	for _, b := range backends {
+		p := b.Config().StoragePath
+		s.checkRead(t, b, "distinct.release", []byte(p))
+		s.checkList(t, b, map[string][]byte{"distinct.release": []byte(p)})
+	}
+}
+
+// testDelete checks deletes of existing and missing files. Deleting a
+// missing file may fail, like the local backend, or succeed, like S3, but
+// mustn't affect other files.
+func (s *suite) testDelete(t *testing.T, b backend.Backend) {
+	err := s.write(b, "deleted.release", []byte("deleted"))
+	if err != nil {
+		t.Errorf("%s: Write(deleted.release): %v", b.Config().StoragePath, err)
+		return
+	}
+
+	err = b.Delete(s.ctx, "deleted.release")
+	if err != nil {
+		t.Errorf("%s: Delete(deleted.release): %v", b.Config().StoragePath, err)
+	}
+	_, err = s.read(b, "deleted.release")
+	if err == nil {
+		t.Errorf("%s: Read of a deleted file succeeded", b.Config().StoragePath)
+	}
+
+	_ = b.Delete(s.ctx, "missing.release")
+	s.checkList(t, b, map[string][]byte{"a.release": []byte("a")})
+}
+
+// testConcurrentWrites checks that concurrent writes of different files all
+// succeed, and that concurrent writes of the same file don't interleave
+func (s *suite) testConcurrentWrites(t *testing.T, b backend.Backend) {
+	contents := make([][]byte, concurrentWriters)
+	for i := range contents {
+		contents[i] = bytes.Repeat([]byte{byte('a' + i)}, 64*1024)
+	}
+
+	var wg sync.WaitGroup
+	for i := range contents {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			err := s.write(b, fmt.Sprintf("concurrent-%d.release", i), contents[i])
+			if err != nil {
+				t.Errorf("%s: Write(concurrent-%d.release): %v", b.Config().StoragePath, i, err)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			err := s.write(b, "shared.release", contents[i])
+			if err != nil {
+				t.Errorf("%s: Write(shared.release): %v", b.Config().StoragePath, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range contents {
+		s.checkRead(t, b, fmt.Sprintf("concurrent-%d.release", i), contents[i])
+	}
+
+	shared, err := s.read(b, "shared.release")
+	if err != nil {
+		t.Errorf("%s: Read(shared.release): %v", b.Config().StoragePath, err)
+		return
+	}
+	for _, c := range contents {
+		if bytes.Equal(shared, c) {
+			return
+		}
+	}
+	t.Errorf("%s: concurrent writes of shared.release interleaved", b.Config().StoragePath)
+}
+
+// testConditionalWrites checks the optimistic concurrency control of
+// backends that implement backend.ConditionalWriter
+func (s *suite) testConditionalWrites(t *testing.T, b backend.Backend) {
+	cw, ok := b.(backend.ConditionalWriter)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	s.written[b]["conditional.release"] = true
+	s.mu.Unlock()
+
+	v1, err := cw.WriteIfMatch(s.ctx, "conditional.release", strings.NewReader("v1"), "")
+	if errors.Is(err, backend.ErrConditionalWriteUnsupported) {
+		return
+	}
+	if err != nil {
+		t.Errorf("%s: WriteIfMatch of a new file: %v", b.Config().StoragePath, err)
+		return
+	}
+
+	_, err = cw.WriteIfMatch(s.ctx, "conditional.release", strings.NewReader("v2"), "")
+	if !errors.Is(err, backend.ErrConflict) {
+		t.Errorf("%s: WriteIfMatch of an existing file as a new file = %v, want ErrConflict", b.Config().StoragePath, err)
+	}
+
+	r, version, err := cw.ReadVersion(s.ctx, "conditional.release")
+	if err != nil {
+		t.Errorf("%s: ReadVersion: %v", b.Config().StoragePath, err)
+		return
+	}
+	_ = r.Close()
+	if version != v1 {
+		t.Errorf("%s: ReadVersion = %s, want the written version %s", b.Config().StoragePath, version, v1)
+	}
+
+	_, err = cw.WriteIfMatch(s.ctx, "conditional.release", strings.NewReader("v2"), v1)
+	if err != nil {
+		t.Errorf("%s: WriteIfMatch of the current version: %v", b.Config().StoragePath, err)
+	}
+	_, err = cw.WriteIfMatch(s.ctx, "conditional.release", strings.NewReader("v3"), v1)
+	if !errors.Is(err, backend.ErrConflict) {
+		t.Errorf("%s: WriteIfMatch of a stale version = %v, want ErrConflict", b.Config().StoragePath, err)
+	}
+	s.checkRead(t, b, "conditional.release", []byte("v2"))
+}
+
+func (s *suite) cleanup() {
+	for b, files := range s.written {
+		for f := range files {
+			_ = b.Delete(s.ctx, f)
+		}
+	}
+}
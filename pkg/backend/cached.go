@@ -0,0 +1,294 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+	"github.com/logicmonitor/k8s-release-manager/pkg/metrics"
+	"github.com/logicmonitor/k8s-release-manager/pkg/utilities"
+	log "github.com/sirupsen/logrus"
+)
+
+const cacheTempSuffix = ".tmp"
+
+// Cached implements the Backend interface by wrapping another Backend and
+// keeping a copy of each file read on local disk, keyed by the file's name
+// and ETag. A cached copy is only used while the ETag of the stored file is
+// unchanged, so modified files are always read from the backend. The least
+// recently used copies are evicted when the cache exceeds its size limit.
+type Cached struct {
+	Backend Backend
+	Opts    *config.CacheConfig
+
+	mu sync.Mutex
+	// the ETags of stored files as of the last listing
+	etags map[string]string
+}
+
+// Init the backend
+func (b *Cached) Init(ctx context.Context) error {
+	b.etags = map[string]string{}
+	// cached files may contain sensitive release values
+	err := utilities.EnsureDirectory(b.Opts.Dir, 0700)
+	if err != nil {
+		return err
+	}
+	return b.Backend.Init(ctx)
+}
+
+// Read opens the specified file from the cache if it is unchanged, otherwise
+// from the backend, caching it as it is read
+func (b *Cached) Read(ctx context.Context, filename string) (io.ReadCloser, error) {
+	etag, err := b.etag(ctx, filename)
+	if err != nil || etag == "" {
+		return b.Backend.Read(ctx, filename)
+	}
+
+	entry := b.entry(filename, etag)
+	f, err := os.Open(entry)
+	if err == nil {
+		log.Debugf("Reading %s from cache", filename)
+		metrics.CacheHit()
+		// mark the entry as recently used
+		now := time.Now()
+		_ = os.Chtimes(entry, now, now)
+		return f, nil
+	}
+	metrics.CacheMiss()
+
+	rc, err := b.Backend.Read(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := ioutil.TempFile(b.Opts.Dir, "*"+cacheTempSuffix)
+	if err != nil {
+		metrics.CacheError()
+		log.Warnf("Error caching %s: %v", filename, err)
+		return rc, nil
+	}
+	return &cacheFill{src: rc, tmp: tmp, entry: entry, cache: b, name: filename}, nil
+}
+
+// ReadVersion opens the specified file from the backend, bypassing the
+// cache, and returns the version of the stored file
+func (b *Cached) ReadVersion(ctx context.Context, filename string) (io.ReadCloser, string, error) {
+	cw, ok := b.Backend.(ConditionalWriter)
+	if !ok {
+		return nil, "", ErrConditionalWriteUnsupported
+	}
+	return cw.ReadVersion(ctx, filename)
+}
+
+// Config returns the backend's config
+func (b *Cached) Config() *config.BackendConfig {
+	return b.Backend.Config()
+}
+
+// Writes the contents to the specified path on the backend
+func (b *Cached) Write(ctx context.Context, filename string, data io.Reader) error {
+	b.invalidate(filename)
+	return b.Backend.Write(ctx, filename, data)
+}
+
+// WriteIfMatch writes the contents to the specified path on the backend if
+// the stored file is still at the specified version
+func (b *Cached) WriteIfMatch(ctx context.Context, filename string, data io.Reader, version string) (string, error) {
+	cw, ok := b.Backend.(ConditionalWriter)
+	if !ok {
+		return "", ErrConditionalWriteUnsupported
+	}
+	b.invalidate(filename)
+	return cw.WriteIfMatch(ctx, filename, data, version)
+}
+
+// Delete deletes the specified file from the backend
+func (b *Cached) Delete(ctx context.Context, filename string) error {
+	b.invalidate(filename)
+	return b.Backend.Delete(ctx, filename)
+}
+
+// List lists all files in the specified path on the backend
+func (b *Cached) List(ctx context.Context) ([]string, error) {
+	objects, err := b.ListDetailed(ctx)
+	return names(objects), err
+}
+
+// ListDetailed lists all files in the specified path on the backend along
+// with their metadata. The listed ETags are used to validate cached files.
+func (b *Cached) ListDetailed(ctx context.Context) ([]*ObjectInfo, error) {
+	objects, err := b.Backend.ListDetailed(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	etags := make(map[string]string, len(objects))
+	for _, o := range objects {
+		etags[o.Name] = o.ETag
+	}
+	b.mu.Lock()
+	b.etags = etags
+	b.mu.Unlock()
+	return objects, nil
+}
+
+// etag returns the ETag of the specified file, listing the backend if the
+// file hasn't been listed since it was last written
+func (b *Cached) etag(ctx context.Context, filename string) (string, error) {
+	b.mu.Lock()
+	etag, ok := b.etags[filename]
+	b.mu.Unlock()
+	if ok {
+		return etag, nil
+	}
+
+	_, err := b.ListDetailed(ctx)
+	if err != nil {
+		return "", err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.etags[filename], nil
+}
+
+// invalidate forgets the ETag of the specified file and removes its cached copies
+func (b *Cached) invalidate(filename string) {
+	b.mu.Lock()
+	delete(b.etags, filename)
+	b.mu.Unlock()
+	b.remove(filename)
+}
+
+// remove removes every cached copy of the specified file
+func (b *Cached) remove(filename string) {
+	entries, err := filepath.Glob(filepath.Join(b.Opts.Dir, b.hash(b.Config().StoragePath, filename)+"-*"))
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		err = os.Remove(e)
+		if err != nil && !os.IsNotExist(err) {
+			metrics.CacheError()
+			log.Warnf("Error removing cached file %s: %v", e, err)
+		}
+	}
+}
+
+// commit moves a completely read file into the cache
+func (b *Cached) commit(tmp *os.File, filename string, entry string, complete bool) {
+	err := tmp.Close()
+	if !complete || err != nil {
+		_ = os.Remove(tmp.Name())
+		return
+	}
+
+	info, err := os.Stat(tmp.Name())
+	if err != nil || info.Size() > b.Opts.MaxSize {
+		_ = os.Remove(tmp.Name())
+		return
+	}
+
+	// replace copies of previous versions of the file
+	b.remove(filename)
+	err = os.Rename(tmp.Name(), entry)
+	if err != nil {
+		metrics.CacheError()
+		log.Warnf("Error caching %s: %v", filename, err)
+		_ = os.Remove(tmp.Name())
+		return
+	}
+	b.evict()
+}
+
+// evict removes the least recently used cached files until the cache is
+// within its size limit
+func (b *Cached) evict() {
+	files, err := ioutil.ReadDir(b.Opts.Dir)
+	if err != nil {
+		metrics.CacheError()
+		log.Warnf("Error reading cache directory %s: %v", b.Opts.Dir, err)
+		return
+	}
+
+	var size int64
+	entries := files[:0]
+	for _, f := range files {
+		if f.IsDir() || strings.HasSuffix(f.Name(), cacheTempSuffix) {
+			continue
+		}
+		size += f.Size()
+		entries = append(entries, f)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ModTime().Before(entries[j].ModTime())
+	})
+	for _, f := range entries {
+		if size <= b.Opts.MaxSize {
+			return
+		}
+		err = os.Remove(filepath.Join(b.Opts.Dir, f.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			metrics.CacheError()
+			log.Warnf("Error evicting cached file %s: %v", f.Name(), err)
+			continue
+		}
+		metrics.CacheEviction()
+		size -= f.Size()
+	}
+}
+
+// entry returns the cache path of the specified version of the file. Files
+// from every storage path share the cache directory.
+func (b *Cached) entry(filename string, etag string) string {
+	return filepath.Join(b.Opts.Dir, b.hash(b.Config().StoragePath, filename)+"-"+b.hash(etag))
+}
+
+func (b *Cached) hash(s ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(s, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// cacheFill copies the contents of a file into a temporary file as they are
+// read from the backend. The copy is only cached if the file is read to the end.
+type cacheFill struct {
+	src   io.ReadCloser
+	tmp   *os.File
+	entry string
+	cache *Cached
+	name  string
+	eof   bool
+	err   error
+}
+
+func (f *cacheFill) Read(p []byte) (int, error) {
+	n, err := f.src.Read(p)
+	if n > 0 && f.err == nil {
+		_, f.err = f.tmp.Write(p[:n])
+	}
+	if err == io.EOF {
+		f.eof = true
+	}
+	return n, err
+}
+
+// Close closes the backend's stream and caches the copy if it is complete
+func (f *cacheFill) Close() error {
+	err := f.src.Close()
+	if f.err != nil {
+		metrics.CacheError()
+		log.Warnf("Error caching %s: %v", f.name, f.err)
+	}
+	f.cache.commit(f.tmp, f.name, f.entry, f.eof && f.err == nil && err == nil)
+	return err
+}
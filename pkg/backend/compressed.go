@@ -0,0 +1,212 @@
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+	"github.com/logicmonitor/k8s-release-manager/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// CompressionNone stores files uncompressed
+	CompressionNone = "none"
+	// CompressionGzip compresses stored files with gzip
+	CompressionGzip = "gzip"
+	// CompressionZstd compresses stored files with zstd
+	CompressionZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Compressed implements the Backend interface by wrapping another Backend and
+// compressing files on write. Compressed files are detected by their magic
+// bytes on read, so uncompressed files are always readable regardless of the
+// configured algorithm.
+type Compressed struct {
+	Algorithm string
+	Backend   Backend
+}
+
+// Init the backend
+func (b *Compressed) Init(ctx context.Context) error {
+	switch b.Algorithm {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return b.Backend.Init(ctx)
+	default:
+		return fmt.Errorf("Unsupported compression algorithm %s", b.Algorithm)
+	}
+}
+
+// Read opens the specified file from the backend for reading and
+// decompresses it as it is read
+func (b *Compressed) Read(ctx context.Context, filename string) (io.ReadCloser, error) {
+	rc, err := b.Backend.Read(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	return decompress(rc)
+}
+
+// ReadVersion opens the specified file from the backend for reading and
+// returns the version of the stored file
+func (b *Compressed) ReadVersion(ctx context.Context, filename string) (io.ReadCloser, string, error) {
+	cw, ok := b.Backend.(ConditionalWriter)
+	if !ok {
+		return nil, "", ErrConditionalWriteUnsupported
+	}
+
+	rc, version, err := cw.ReadVersion(ctx, filename)
+	if err != nil {
+		return nil, "", err
+	}
+	r, err := decompress(rc)
+	return r, version, err
+}
+
+// decompress returns a reader that decompresses the stream as it is read
+func decompress(rc io.ReadCloser) (io.ReadCloser, error) {
+	// files shorter than the magic bytes can't be compressed
+	br := bufio.NewReader(rc)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		_ = rc.Close()
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		r, err := gzip.NewReader(br)
+		if err != nil {
+			_ = rc.Close()
+			return nil, err
+		}
+		return &readCloser{Reader: r, close: rc.Close}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		r, err := zstd.NewReader(br)
+		if err != nil {
+			_ = rc.Close()
+			return nil, err
+		}
+		return &readCloser{Reader: r, close: func() error {
+			r.Close()
+			return rc.Close()
+		}}, nil
+	default:
+		return &readCloser{Reader: br, close: rc.Close}, nil
+	}
+}
+
+// Config returns the backend's config
+func (b *Compressed) Config() *config.BackendConfig {
+	return b.Backend.Config()
+}
+
+// Writes the compressed contents to the specified path on the backend. The
+// contents are compressed as they are written.
+func (b *Compressed) Write(ctx context.Context, filename string, data io.Reader) error {
+	return b.write(filename, data, func(r io.Reader) error {
+		return b.Backend.Write(ctx, filename, r)
+	})
+}
+
+// WriteIfMatch writes the compressed contents to the specified path on the
+// backend if the stored file is still at the specified version
+func (b *Compressed) WriteIfMatch(ctx context.Context, filename string, data io.Reader, version string) (ret string, err error) {
+	cw, ok := b.Backend.(ConditionalWriter)
+	if !ok {
+		return "", ErrConditionalWriteUnsupported
+	}
+
+	err = b.write(filename, data, func(r io.Reader) (err error) {
+		ret, err = cw.WriteIfMatch(ctx, filename, r, version)
+		return err
+	})
+	return ret, err
+}
+
+// write passes the compressed contents to the specified write func
+func (b *Compressed) write(filename string, data io.Reader, write func(io.Reader) error) error {
+	if b.Algorithm == CompressionNone {
+		return write(data)
+	}
+
+	pr, pw := io.Pipe()
+	in := &countingReader{Reader: data}
+	out := &countingReader{Reader: pr}
+	go func() {
+		pw.CloseWithError(b.compress(pw, in)) // nolint: errcheck
+	}()
+
+	err := write(out)
+	// unblock the compressor if the backend stopped reading early
+	pr.CloseWithError(err) // nolint: errcheck
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Compressed %s from %d to %d bytes", filename, in.n, out.n)
+	metrics.CompressionSaved(int(in.n - out.n))
+	return nil
+}
+
+// Delete deletes the specified file from the backend
+func (b *Compressed) Delete(ctx context.Context, filename string) error {
+	return b.Backend.Delete(ctx, filename)
+}
+
+// List lists all files in the specified path on the backend
+func (b *Compressed) List(ctx context.Context) ([]string, error) {
+	return b.Backend.List(ctx)
+}
+
+// ListDetailed lists all files in the specified path on the backend along
+// with the metadata of the stored, i.e. compressed, contents
+func (b *Compressed) ListDetailed(ctx context.Context) ([]*ObjectInfo, error) {
+	return b.Backend.ListDetailed(ctx)
+}
+
+func (b *Compressed) compress(dst io.Writer, src io.Reader) error {
+	var w io.WriteCloser
+	var err error
+
+	switch b.Algorithm {
+	case CompressionZstd:
+		w, err = zstd.NewWriter(dst)
+	default:
+		w, err = gzip.NewWriterLevel(dst, gzip.BestCompression)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, src)
+	if err != nil {
+		_ = w.Close()
+		return err
+	}
+
+	// flush the remaining data and footer
+	return w.Close()
+}
+
+// countingReader counts the bytes read from the underlying Reader
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,436 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+	"github.com/logicmonitor/k8s-release-manager/pkg/constants"
+	"github.com/logicmonitor/k8s-release-manager/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ageKeyID         = "age"
+	dataKeySize      = 32
+	masterKeyIDBytes = 8
+)
+
+// Encrypted implements the Backend interface by wrapping another Backend and
+// transparently encrypting files on write and decrypting them on read. Each
+// file is encrypted with a random AES-GCM data key, which is in turn wrapped
+// by either a local master key or a set of age recipients.
+type Encrypted struct {
+	Backend Backend
+	Opts    *config.EncryptionConfig
+
+	// the key used to wrap data keys for new files
+	primary string
+	// master keys by key id, including keys retained for decryption only
+	masterKeys    map[string][]byte
+	ageIdentities []age.Identity
+	ageRecipients []age.Recipient
+}
+
+// envelopeHeader describes how to recover the data key for an encrypted file
+type envelopeHeader struct {
+	KeyID      string `json:"kid"`
+	WrappedKey []byte `json:"key"`
+	Nonce      []byte `json:"nonce"`
+}
+
+// Init the backend
+func (b *Encrypted) Init(ctx context.Context) error {
+	b.masterKeys = map[string][]byte{}
+	for _, f := range b.Opts.DecryptionKeyFiles {
+		_, err := b.loadMasterKey(f)
+		if err != nil {
+			return err
+		}
+	}
+
+	if b.Opts.KeyFile != "" {
+		id, err := b.loadMasterKey(b.Opts.KeyFile)
+		if err != nil {
+			return err
+		}
+		b.primary = id
+	}
+
+	err := b.loadAge()
+	if err != nil {
+		return err
+	}
+	return b.Backend.Init(ctx)
+}
+
+// Read opens and decrypts the specified file from the backend. The file is
+// buffered in memory since it must be authenticated before it is returned.
+func (b *Encrypted) Read(ctx context.Context, filename string) (io.ReadCloser, error) {
+	data, err := readAll(ctx, b.Backend, filename)
+	if err != nil {
+		return nil, err
+	}
+	return b.open(filename, data)
+}
+
+// ReadVersion opens and decrypts the specified file from the backend and
+// returns the version of the stored file
+func (b *Encrypted) ReadVersion(ctx context.Context, filename string) (io.ReadCloser, string, error) {
+	cw, ok := b.Backend.(ConditionalWriter)
+	if !ok {
+		return nil, "", ErrConditionalWriteUnsupported
+	}
+
+	rc, version, err := cw.ReadVersion(ctx, filename)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rc.Close() // nolint: errcheck
+
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, "", err
+	}
+	r, err := b.open(filename, data)
+	return r, version, err
+}
+
+// open returns a reader for the decrypted contents of the file
+func (b *Encrypted) open(filename string, data []byte) (io.ReadCloser, error) {
+	// files written before encryption was enabled are only returned as is
+	// when explicitly allowed, otherwise anyone able to write to the backend
+	// could substitute plaintext for an encrypted file
+	if !IsEncrypted(data) {
+		if !b.Opts.AllowUnencrypted {
+			metrics.EncryptionError()
+			return nil, fmt.Errorf("%s is not encrypted. Use --allow-unencrypted to read it and export --reencrypt to encrypt it", filename)
+		}
+		metrics.UnencryptedRead()
+		log.Warnf("%s is not encrypted. Use export --reencrypt to encrypt it", filename)
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	plaintext, err := b.decrypt(data)
+	if err != nil {
+		metrics.EncryptionError()
+		return nil, fmt.Errorf("Error decrypting %s: %v", filename, err)
+	}
+	return ioutil.NopCloser(bytes.NewReader(plaintext)), nil
+}
+
+// Config returns the backend's config
+func (b *Encrypted) Config() *config.BackendConfig {
+	return b.Backend.Config()
+}
+
+// Writes the encrypted contents to the specified path on the backend
+func (b *Encrypted) Write(ctx context.Context, filename string, data io.Reader) error {
+	ciphertext, err := b.seal(filename, data)
+	if err != nil {
+		return err
+	}
+	return b.Backend.Write(ctx, filename, ciphertext)
+}
+
+// WriteIfMatch writes the encrypted contents to the specified path on the
+// backend if the stored file is still at the specified version
+func (b *Encrypted) WriteIfMatch(ctx context.Context, filename string, data io.Reader, version string) (string, error) {
+	cw, ok := b.Backend.(ConditionalWriter)
+	if !ok {
+		return "", ErrConditionalWriteUnsupported
+	}
+
+	ciphertext, err := b.seal(filename, data)
+	if err != nil {
+		return "", err
+	}
+	return cw.WriteIfMatch(ctx, filename, ciphertext, version)
+}
+
+// seal returns a reader for the encrypted envelope of the contents
+func (b *Encrypted) seal(filename string, data io.Reader) (io.Reader, error) {
+	plaintext, err := ioutil.ReadAll(data)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := b.encrypt(plaintext)
+	if err != nil {
+		metrics.EncryptionError()
+		return nil, fmt.Errorf("Error encrypting %s: %v", filename, err)
+	}
+	return bytes.NewReader(ciphertext), nil
+}
+
+// Delete deletes the specified file from the backend
+func (b *Encrypted) Delete(ctx context.Context, filename string) error {
+	return b.Backend.Delete(ctx, filename)
+}
+
+// List lists all files in the specified path on the backend
+func (b *Encrypted) List(ctx context.Context) ([]string, error) {
+	return b.Backend.List(ctx)
+}
+
+// ListDetailed lists all files in the specified path on the backend along
+// with the metadata of the stored, i.e. encrypted, contents
+func (b *Encrypted) ListDetailed(ctx context.Context) ([]*ObjectInfo, error) {
+	return b.Backend.ListDetailed(ctx)
+}
+
+// Rotate re-encrypts every stored file that isn't encrypted with the current
+// key, including files that were stored before encryption was enabled if
+// AllowUnencrypted is set.
+// Files encrypted for age recipients are always re-encrypted since the
+// recipients can't be recovered from the file.
+func (b *Encrypted) Rotate(ctx context.Context) error {
+	files, err := b.Backend.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		data, err := readAll(ctx, b.Backend, f)
+		if err != nil {
+			return err
+		}
+
+		if IsEncrypted(data) {
+			header, _, err := parseEnvelope(data)
+			if err != nil {
+				return fmt.Errorf("Error parsing %s: %v", f, err)
+			}
+			if header.KeyID == b.primary && header.KeyID != ageKeyID {
+				continue
+			}
+		}
+
+		log.Infof("Re-encrypting %s", f)
+		plaintext, err := readAll(ctx, b, f)
+		if err != nil {
+			return err
+		}
+		err = b.Write(ctx, f, bytes.NewReader(plaintext))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsEncrypted returns true if the data is an encrypted envelope
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(constants.EncryptedFileMagic))
+}
+
+func (b *Encrypted) encrypt(plaintext []byte) ([]byte, error) {
+	if b.primary == "" {
+		return nil, fmt.Errorf("no encryption key or age recipients are configured")
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header := &envelopeHeader{KeyID: b.primary}
+	header.WrappedKey, err = b.wrap(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	header.Nonce, err = nonce(gcm)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+
+	// magic | header length | header | ciphertext
+	var buf bytes.Buffer
+	buf.WriteString(constants.EncryptedFileMagic)
+	err = binary.Write(&buf, binary.BigEndian, uint32(len(h)))
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(h)
+	buf.Write(gcm.Seal(nil, header.Nonce, plaintext, h))
+	return buf.Bytes(), nil
+}
+
+func (b *Encrypted) decrypt(data []byte) ([]byte, error) {
+	header, ciphertext, err := parseEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := b.unwrap(header)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// the header is authenticated as additional data
+	h := data[len(constants.EncryptedFileMagic)+4 : len(data)-len(ciphertext)]
+	return gcm.Open(nil, header.Nonce, ciphertext, h)
+}
+
+func (b *Encrypted) wrap(dataKey []byte) ([]byte, error) {
+	if b.primary == ageKeyID {
+		var buf bytes.Buffer
+		w, err := age.Encrypt(&buf, b.ageRecipients...)
+		if err != nil {
+			return nil, err
+		}
+		_, err = w.Write(dataKey)
+		if err != nil {
+			return nil, err
+		}
+		err = w.Close()
+		return buf.Bytes(), err
+	}
+
+	gcm, err := newGCM(b.masterKeys[b.primary])
+	if err != nil {
+		return nil, err
+	}
+	n, err := nonce(gcm)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(n, n, dataKey, nil), nil
+}
+
+func (b *Encrypted) unwrap(header *envelopeHeader) ([]byte, error) {
+	if header.KeyID == ageKeyID {
+		if len(b.ageIdentities) == 0 {
+			return nil, fmt.Errorf("the file is encrypted for age recipients but no age identity is configured")
+		}
+		r, err := age.Decrypt(bytes.NewReader(header.WrappedKey), b.ageIdentities...)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(r)
+	}
+
+	key, ok := b.masterKeys[header.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("the file is encrypted with master key %s which is not configured", header.KeyID)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(header.WrappedKey) < gcm.NonceSize() {
+		return nil, fmt.Errorf("the wrapped data key is truncated")
+	}
+	n := gcm.NonceSize()
+	return gcm.Open(nil, header.WrappedKey[:n], header.WrappedKey[n:], nil)
+}
+
+// loadMasterKey reads a base64 encoded 256-bit key from the specified file and
+// returns its key id
+func (b *Encrypted) loadMasterKey(filename string) (string, error) {
+	f, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(f)))
+	if err != nil || len(key) != dataKeySize {
+		return "", fmt.Errorf("%s must contain a base64 encoded 256-bit key", filename)
+	}
+
+	sum := sha256.Sum256(key)
+	id := hex.EncodeToString(sum[:masterKeyIDBytes])
+	b.masterKeys[id] = key
+	return id, nil
+}
+
+func (b *Encrypted) loadAge() error {
+	if len(b.Opts.AgeRecipients) > 0 {
+		r, err := age.ParseRecipients(strings.NewReader(strings.Join(b.Opts.AgeRecipients, "\n")))
+		if err != nil {
+			return err
+		}
+		b.ageRecipients = r
+		b.primary = ageKeyID
+	}
+
+	if b.Opts.AgeIdentityFile != "" {
+		f, err := os.Open(b.Opts.AgeIdentityFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close() // nolint: errcheck
+
+		identities, err := age.ParseIdentities(f)
+		if err != nil {
+			return err
+		}
+		b.ageIdentities = identities
+	}
+	return nil
+}
+
+func parseEnvelope(data []byte) (*envelopeHeader, []byte, error) {
+	data = data[len(constants.EncryptedFileMagic):]
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("the encrypted envelope is truncated")
+	}
+
+	n := binary.BigEndian.Uint32(data)
+	data = data[4:]
+	if uint64(len(data)) < uint64(n) {
+		return nil, nil, fmt.Errorf("the encrypted envelope is truncated")
+	}
+
+	header := &envelopeHeader{}
+	err := json.Unmarshal(data[:n], header)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, data[n:], nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func nonce(gcm cipher.AEAD) ([]byte, error) {
+	n := make([]byte, gcm.NonceSize())
+	_, err := rand.Read(n)
+	return n, err
+}
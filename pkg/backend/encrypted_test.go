@@ -0,0 +1,66 @@
+package backend
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+)
+
+func TestEncryptedUnencryptedRead(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "encrypted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	keyFile := filepath.Join(dir, "key")
+	err = ioutil.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(make([]byte, dataKeySize))), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &Memory{BackendConfig: &config.BackendConfig{StoragePath: "releases"}}
+	opts := &config.EncryptionConfig{KeyFile: keyFile}
+	b := &Encrypted{Backend: store, Opts: opts}
+	err = b.Init(ctx)
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	// written without encryption, e.g. before encryption was enabled
+	err = store.Write(ctx, "plain.release", strings.NewReader("plaintext"))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	_, err = b.Read(ctx, "plain.release")
+	if err == nil {
+		t.Fatal("Read of an unencrypted file succeeded without AllowUnencrypted")
+	}
+
+	opts.AllowUnencrypted = true
+	r, err := b.Read(ctx, "plain.release")
+	if err != nil {
+		t.Fatalf("Read with AllowUnencrypted: %v", err)
+	}
+	data, err := ioutil.ReadAll(r)
+	r.Close() // nolint: errcheck
+	if err != nil || string(data) != "plaintext" {
+		t.Fatalf("Read with AllowUnencrypted returned %q, %v", data, err)
+	}
+
+	err = b.Rotate(ctx)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	raw, err := readAll(ctx, store, "plain.release")
+	if err != nil || !IsEncrypted(raw) {
+		t.Fatalf("Rotate left the file unencrypted: %v", err)
+	}
+}
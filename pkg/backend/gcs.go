@@ -0,0 +1,191 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+	"github.com/logicmonitor/k8s-release-manager/pkg/metrics"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// GCS implements the Backend interface
+type GCS struct {
+	BackendConfig *config.BackendConfig
+	Opts          *GCSOpts
+	client        *storage.Client
+}
+
+// GCSOpts represents the GCS backend configuration options
+type GCSOpts struct {
+	Auth     *GCSAuth
+	Bucket   string
+	Endpoint string
+}
+
+// GCSAuth represents the GCS backend authentication configuration options
+type GCSAuth struct {
+	Anonymous       bool
+	CredentialsFile string
+}
+
+func init() {
+	Register("gs", newGCSFromURL)
+}
+
+// newGCSFromURL returns the GCS backend for gs://bucket/path. The query sets
+// the credentialsFile, anonymous and endpoint options.
+func newGCSFromURL(u *url.URL, cfg *config.BackendConfig) (Backend, error) {
+	err := requireHost(u, "bucket")
+	if err != nil {
+		return nil, err
+	}
+	anonymous, err := queryBool(u, "anonymous")
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+	if anonymous && q.Get("credentialsFile") != "" {
+		return nil, fmt.Errorf("anonymous and credentialsFile are mutually exclusive")
+	}
+	return &GCS{
+		BackendConfig: cfg,
+		Opts: &GCSOpts{
+			Auth: &GCSAuth{
+				Anonymous:       anonymous,
+				CredentialsFile: q.Get("credentialsFile"),
+			},
+			Bucket:   u.Host,
+			Endpoint: q.Get("endpoint"),
+		},
+	}, nil
+}
+
+// Init the backend
+func (b *GCS) Init(ctx context.Context) error {
+	client, err := storage.NewClient(ctx, b.clientOptions()...)
+	if err != nil {
+		return b.checkError(err)
+	}
+	b.client = client
+	return nil
+}
+
+// Read opens the specified file from the backend for reading
+func (b *GCS) Read(ctx context.Context, filename string) (io.ReadCloser, error) {
+	r, err := b.object(filename).NewReader(ctx)
+	if err != nil {
+		return nil, b.checkError(err)
+	}
+	return r, nil
+}
+
+// Config returns the backend's config
+func (b *GCS) Config() *config.BackendConfig {
+	return b.BackendConfig
+}
+
+// Writes the contents to the specified path on the backend
+func (b *GCS) Write(ctx context.Context, filename string, data io.Reader) error {
+	w := b.object(filename).NewWriter(ctx)
+	_, err := io.Copy(w, data)
+	if err != nil {
+		_ = w.Close()
+		return b.checkError(err)
+	}
+
+	// the object isn't committed until the writer is closed
+	err = w.Close()
+	if err != nil {
+		return b.checkError(err)
+	}
+	return nil
+}
+
+// Delete deletes the specified file from the backend
+func (b *GCS) Delete(ctx context.Context, filename string) error {
+	err := b.object(filename).Delete(ctx)
+	if err != nil {
+		return b.checkError(err)
+	}
+	return nil
+}
+
+// List lists all files in the specified path on the backend
+func (b *GCS) List(ctx context.Context) ([]string, error) {
+	objects, err := b.ListDetailed(ctx)
+	return names(objects), err
+}
+
+// ListDetailed lists all files in the specified path on the backend along
+// with their metadata
+func (b *GCS) ListDetailed(ctx context.Context) (ret []*ObjectInfo, err error) {
+	path := b.path("")
+	it := b.client.Bucket(b.Opts.Bucket).Objects(ctx, &storage.Query{
+		Delimiter: delimiter,
+		Prefix:    path,
+	})
+
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, b.checkError(err)
+		}
+
+		// skip synthetic directory entries
+		if attrs.Prefix != "" {
+			continue
+		}
+
+		ret = append(ret, &ObjectInfo{
+			// trim the leading path from the filename
+			Name:    strings.Replace(attrs.Name, path, "", 1),
+			Size:    attrs.Size,
+			ModTime: attrs.Updated,
+			ETag:    attrs.Etag,
+		})
+	}
+	return ret, nil
+}
+
+func (b *GCS) object(filename string) *storage.ObjectHandle {
+	return b.client.Bucket(b.Opts.Bucket).Object(b.path(filename))
+}
+
+func (b *GCS) path(filename string) string {
+	return objectPath(b.BackendConfig.StoragePath, filename)
+}
+
+func (b *GCS) clientOptions() (opts []option.ClientOption) {
+	if b.Opts.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(b.Opts.Endpoint))
+	}
+
+	switch {
+	case b.Opts.Auth.Anonymous:
+		opts = append(opts, option.WithoutAuthentication())
+	case b.Opts.Auth.CredentialsFile != "":
+		opts = append(opts, option.WithCredentialsFile(b.Opts.Auth.CredentialsFile))
+	}
+
+	// fall back to application default credentials
+	return opts
+}
+
+func (b *GCS) checkError(err error) error {
+	metrics.GCSError()
+	if errors.Is(err, storage.ErrBucketNotExist) {
+		return fmt.Errorf("%s %s", b.Opts.Bucket, err.Error())
+	}
+	return err
+}
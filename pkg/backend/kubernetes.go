@@ -0,0 +1,373 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+	"github.com/logicmonitor/k8s-release-manager/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// KubernetesKindSecret stores files as Secrets
+	KubernetesKindSecret = "secret"
+	// KubernetesKindConfigMap stores files as ConfigMaps
+	KubernetesKindConfigMap = "configmap"
+
+	// leave headroom below the 1MiB object limit for the object's metadata
+	kubernetesChunkSize = 1024*1024 - 64*1024
+	kubernetesDataKey   = "data"
+	kubernetesHashLen   = 16
+
+	kubernetesLabelManagedBy       = "app.kubernetes.io/managed-by"
+	kubernetesLabelPath            = "releasemanager.logicmonitor.com/path"
+	kubernetesLabelFile            = "releasemanager.logicmonitor.com/file"
+	kubernetesAnnotationFilename   = "releasemanager.logicmonitor.com/filename"
+	kubernetesAnnotationChunk      = "releasemanager.logicmonitor.com/chunk"
+	kubernetesAnnotationChunkCount = "releasemanager.logicmonitor.com/chunks"
+	kubernetesAnnotationModTime    = "releasemanager.logicmonitor.com/modified"
+	kubernetesAnnotationSHA256     = "releasemanager.logicmonitor.com/sha256"
+	kubernetesManagedBy            = "releasemanager"
+)
+
+// Kubernetes implements the Backend interface
+type Kubernetes struct {
+	BackendConfig *config.BackendConfig
+	Opts          *KubernetesOpts
+	clientset     kubernetes.Interface
+}
+
+// KubernetesOpts represents the Kubernetes backend configuration options
+type KubernetesOpts struct {
+	Kind        string
+	KubeConfig  string
+	KubeContext string
+	Namespace   string
+}
+
+// kubernetesChunk is a kind-agnostic view of a single stored Secret or ConfigMap
+type kubernetesChunk struct {
+	name        string
+	annotations map[string]string
+	data        []byte
+}
+
+func init() {
+	Register("kubernetes", newKubernetesFromURL)
+}
+
+// newKubernetesFromURL returns the Kubernetes backend for
+// kubernetes://namespace/path. The query sets the kind, kubeconfig and
+// kubecontext options.
+func newKubernetesFromURL(u *url.URL, cfg *config.BackendConfig) (Backend, error) {
+	err := requireHost(u, "namespace")
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+	kind := q.Get("kind")
+	if kind == "" {
+		kind = KubernetesKindSecret
+	}
+	if kind != KubernetesKindSecret && kind != KubernetesKindConfigMap {
+		return nil, fmt.Errorf("kind must be one of %s or %s", KubernetesKindSecret, KubernetesKindConfigMap)
+	}
+	return &Kubernetes{
+		BackendConfig: cfg,
+		Opts: &KubernetesOpts{
+			Kind:        kind,
+			KubeConfig:  q.Get("kubeconfig"),
+			KubeContext: q.Get("kubecontext"),
+			Namespace:   u.Host,
+		},
+	}, nil
+}
+
+// Init the backend
+func (b *Kubernetes) Init(ctx context.Context) error {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = b.Opts.KubeConfig
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{
+		CurrentContext: b.Opts.KubeContext,
+	}).ClientConfig()
+	if err != nil {
+		return b.checkError(err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return b.checkError(err)
+	}
+	b.clientset = clientset
+	return nil
+}
+
+// Read opens the specified file from the backend for reading. The chunks
+// are fetched up front since they're returned in a single list request.
+func (b *Kubernetes) Read(ctx context.Context, filename string) (io.ReadCloser, error) {
+	chunks, err := b.chunks(ctx, filename)
+	if err != nil {
+		return nil, b.checkError(err)
+	}
+	if len(chunks) == 0 {
+		return nil, b.checkError(fmt.Errorf("%s not found in namespace %s", filename, b.Opts.Namespace))
+	}
+
+	count, err := strconv.Atoi(chunks[0].annotations[kubernetesAnnotationChunkCount])
+	if err != nil || count != len(chunks) {
+		return nil, b.checkError(fmt.Errorf("%s is incomplete: found %d of %s chunks", filename, len(chunks), chunks[0].annotations[kubernetesAnnotationChunkCount]))
+	}
+
+	readers := make([]io.Reader, 0, len(chunks))
+	for _, c := range chunks {
+		readers = append(readers, bytes.NewReader(c.data))
+	}
+	return ioutil.NopCloser(io.MultiReader(readers...)), nil
+}
+
+// Config returns the backend's config
+func (b *Kubernetes) Config() *config.BackendConfig {
+	return b.BackendConfig
+}
+
+// Writes the contents to the specified path on the backend
+func (b *Kubernetes) Write(ctx context.Context, filename string, data io.Reader) error {
+	f, err := ioutil.ReadAll(data)
+	if err != nil {
+		return b.checkError(err)
+	}
+
+	count := (len(f) + kubernetesChunkSize - 1) / kubernetesChunkSize
+	if count == 0 {
+		count = 1
+	}
+	sum := sha256.Sum256(f)
+	modTime := time.Now().UTC().Format(time.RFC3339)
+
+	for i := 0; i < count; i++ {
+		end := (i + 1) * kubernetesChunkSize
+		if end > len(f) {
+			end = len(f)
+		}
+		err = b.apply(ctx, &kubernetesChunk{
+			name: b.chunkName(filename, i),
+			annotations: map[string]string{
+				kubernetesAnnotationFilename:   filename,
+				kubernetesAnnotationChunk:      strconv.Itoa(i),
+				kubernetesAnnotationChunkCount: strconv.Itoa(count),
+				kubernetesAnnotationModTime:    modTime,
+				kubernetesAnnotationSHA256:     hex.EncodeToString(sum[:]),
+			},
+			data: f[i*kubernetesChunkSize : end],
+		}, b.labels(filename))
+		if err != nil {
+			return b.checkError(err)
+		}
+	}
+
+	// remove chunks left over from a previously larger version of the file
+	chunks, err := b.chunks(ctx, filename)
+	if err != nil {
+		return b.checkError(err)
+	}
+	for i := count; i < len(chunks); i++ {
+		err = b.remove(ctx, chunks[i].name)
+		if err != nil {
+			return b.checkError(err)
+		}
+	}
+	return nil
+}
+
+// Delete deletes the specified file from the backend
+func (b *Kubernetes) Delete(ctx context.Context, filename string) error {
+	chunks, err := b.chunks(ctx, filename)
+	if err != nil {
+		return b.checkError(err)
+	}
+	if len(chunks) == 0 {
+		return b.checkError(fmt.Errorf("%s not found in namespace %s", filename, b.Opts.Namespace))
+	}
+
+	for _, c := range chunks {
+		err = b.remove(ctx, c.name)
+		if err != nil {
+			return b.checkError(err)
+		}
+	}
+	return nil
+}
+
+// List lists all files in the specified path on the backend
+func (b *Kubernetes) List(ctx context.Context) ([]string, error) {
+	objects, err := b.ListDetailed(ctx)
+	return names(objects), err
+}
+
+// ListDetailed lists all files in the specified path on the backend along
+// with their metadata. Files written before the metadata annotations were
+// added are listed without a modification time or digest.
+func (b *Kubernetes) ListDetailed(ctx context.Context) (ret []*ObjectInfo, err error) {
+	chunks, err := b.list(ctx, labels.Set{
+		kubernetesLabelManagedBy: kubernetesManagedBy,
+		kubernetesLabelPath:      b.hash(b.path("")),
+	})
+	if err != nil {
+		return nil, b.checkError(err)
+	}
+
+	// every file has exactly one first chunk, which holds the file's metadata
+	files := map[string]*ObjectInfo{}
+	for _, c := range chunks {
+		if c.annotations[kubernetesAnnotationChunk] != "0" {
+			continue
+		}
+		info := &ObjectInfo{
+			Name:   c.annotations[kubernetesAnnotationFilename],
+			ETag:   c.annotations[kubernetesAnnotationSHA256],
+			SHA256: c.annotations[kubernetesAnnotationSHA256],
+		}
+		info.ModTime, _ = time.Parse(time.RFC3339, c.annotations[kubernetesAnnotationModTime])
+		files[info.Name] = info
+		ret = append(ret, info)
+	}
+
+	for _, c := range chunks {
+		if info, ok := files[c.annotations[kubernetesAnnotationFilename]]; ok {
+			info.Size += int64(len(c.data))
+		}
+	}
+	return ret, nil
+}
+
+// chunks returns the stored chunks of the specified file ordered by index
+func (b *Kubernetes) chunks(ctx context.Context, filename string) ([]*kubernetesChunk, error) {
+	chunks, err := b.list(ctx, b.labels(filename))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(chunks, func(i, j int) bool {
+		x, _ := strconv.Atoi(chunks[i].annotations[kubernetesAnnotationChunk])
+		y, _ := strconv.Atoi(chunks[j].annotations[kubernetesAnnotationChunk])
+		return x < y
+	})
+	return chunks, nil
+}
+
+func (b *Kubernetes) list(ctx context.Context, set labels.Set) (ret []*kubernetesChunk, err error) {
+	opts := metav1.ListOptions{LabelSelector: set.String()}
+	switch b.Opts.Kind {
+	case KubernetesKindConfigMap:
+		list, err := b.clientset.CoreV1().ConfigMaps(b.Opts.Namespace).List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, cm := range list.Items {
+			ret = append(ret, &kubernetesChunk{
+				name:        cm.Name,
+				annotations: cm.Annotations,
+				data:        cm.BinaryData[kubernetesDataKey],
+			})
+		}
+	default:
+		list, err := b.clientset.CoreV1().Secrets(b.Opts.Namespace).List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range list.Items {
+			ret = append(ret, &kubernetesChunk{
+				name:        s.Name,
+				annotations: s.Annotations,
+				data:        s.Data[kubernetesDataKey],
+			})
+		}
+	}
+	return ret, nil
+}
+
+// apply creates the chunk or replaces it if it already exists
+func (b *Kubernetes) apply(ctx context.Context, c *kubernetesChunk, set labels.Set) (err error) {
+	meta := metav1.ObjectMeta{
+		Name:        c.name,
+		Namespace:   b.Opts.Namespace,
+		Labels:      set,
+		Annotations: c.annotations,
+	}
+
+	switch b.Opts.Kind {
+	case KubernetesKindConfigMap:
+		cm := &corev1.ConfigMap{
+			ObjectMeta: meta,
+			BinaryData: map[string][]byte{kubernetesDataKey: c.data},
+		}
+		_, err = b.clientset.CoreV1().ConfigMaps(b.Opts.Namespace).Create(ctx, cm, metav1.CreateOptions{})
+		if kerrors.IsAlreadyExists(err) {
+			_, err = b.clientset.CoreV1().ConfigMaps(b.Opts.Namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		}
+	default:
+		s := &corev1.Secret{
+			ObjectMeta: meta,
+			Type:       corev1.SecretTypeOpaque,
+			Data:       map[string][]byte{kubernetesDataKey: c.data},
+		}
+		_, err = b.clientset.CoreV1().Secrets(b.Opts.Namespace).Create(ctx, s, metav1.CreateOptions{})
+		if kerrors.IsAlreadyExists(err) {
+			_, err = b.clientset.CoreV1().Secrets(b.Opts.Namespace).Update(ctx, s, metav1.UpdateOptions{})
+		}
+	}
+	return err
+}
+
+func (b *Kubernetes) remove(ctx context.Context, name string) error {
+	switch b.Opts.Kind {
+	case KubernetesKindConfigMap:
+		return b.clientset.CoreV1().ConfigMaps(b.Opts.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	default:
+		return b.clientset.CoreV1().Secrets(b.Opts.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	}
+}
+
+func (b *Kubernetes) labels(filename string) labels.Set {
+	return labels.Set{
+		kubernetesLabelManagedBy: kubernetesManagedBy,
+		kubernetesLabelPath:      b.hash(b.path("")),
+		kubernetesLabelFile:      b.hash(b.path(filename)),
+	}
+}
+
+// object names are derived from a hash of the full path since release
+// filenames and storage paths aren't guaranteed to be valid resource names
+func (b *Kubernetes) chunkName(filename string, chunk int) string {
+	return fmt.Sprintf("%s-%s-%d", kubernetesManagedBy, b.hash(b.path(filename)), chunk)
+}
+
+func (b *Kubernetes) path(filename string) string {
+	return objectPath(b.BackendConfig.StoragePath, filename)
+}
+
+func (b *Kubernetes) hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:kubernetesHashLen]
+}
+
+func (b *Kubernetes) checkError(err error) error {
+	metrics.KubernetesError()
+	return err
+}
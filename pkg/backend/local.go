@@ -1,10 +1,20 @@
 package backend
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/logicmonitor/k8s-release-manager/pkg/config"
 	"github.com/logicmonitor/k8s-release-manager/pkg/metrics"
@@ -12,6 +22,21 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// DefaultLocalFileMode is the default permissions of files written by the local backend
+	DefaultLocalFileMode os.FileMode = 0644
+	// DefaultLocalDirMode is the default permissions of the local backend's directory
+	DefaultLocalDirMode os.FileMode = 0755
+
+	localLockSuffix        = ".lock"
+	localMetadataSuffix    = ".meta.json"
+	localTempSuffix        = ".tmp"
+	localLockRetryInterval = 100 * time.Millisecond
+	// locks older than this were abandoned by a writer that exited while
+	// holding them
+	localLockTimeout = time.Minute
+)
+
 // Local implements the Backend interface
 type Local struct {
 	BackendConfig *config.BackendConfig
@@ -20,16 +45,52 @@ type Local struct {
 
 // LocalOpts represents the local backend configuration options
 type LocalOpts struct {
+	DirMode  os.FileMode
+	FileMode os.FileMode
+}
+
+func init() {
+	Register("file", newLocalFromURL)
+}
+
+// newLocalFromURL returns the local backend for file:///path. The query sets
+// the octal dirMode and fileMode options.
+func newLocalFromURL(u *url.URL, cfg *config.BackendConfig) (Backend, error) {
+	if u.Host != "" {
+		return nil, fmt.Errorf("The file backend URL must have an absolute path and no host, e.g. file:///path")
+	}
+
+	opts := &LocalOpts{}
+	for key, mode := range map[string]*os.FileMode{"dirMode": &opts.DirMode, "fileMode": &opts.FileMode} {
+		v := u.Query().Get(key)
+		if v == "" {
+			continue
+		}
+		m, err := strconv.ParseUint(v, 8, 32)
+		if err != nil || m > 0777 {
+			return nil, fmt.Errorf("%s must be octal permissions, e.g. 0644", key)
+		}
+		*mode = os.FileMode(m)
+	}
+	return &Local{
+		BackendConfig: cfg,
+		Opts:          opts,
+	}, nil
 }
 
 // Init the backend
-func (b *Local) Init() error {
-	return utilities.EnsureDirectory(b.path(""))
+func (b *Local) Init(ctx context.Context) error {
+	return utilities.EnsureDirectory(b.path(""), b.dirMode())
 }
 
-// Read reads the specified file from the backend
-func (b *Local) Read(filename string) ([]byte, error) {
-	return ioutil.ReadFile(b.path(filename))
+// Read opens the specified file from the backend for reading
+func (b *Local) Read(ctx context.Context, filename string) (io.ReadCloser, error) {
+	f, err := os.Open(b.path(filename))
+	if err != nil {
+		metrics.LocalError()
+		return nil, err
+	}
+	return f, nil
 }
 
 // Config returns the backend's config
@@ -37,45 +98,98 @@ func (b *Local) Config() *config.BackendConfig {
 	return b.BackendConfig
 }
 
-// Writes the contents to the specified path on the backend
-func (b *Local) Write(filename string, data io.Reader) error {
-	buf := make([]byte, 1024)
-	f, err := os.Create(b.path(filename))
+// Writes the contents to the specified path on the backend. The contents are
+// written to a temporary file which is synced and renamed over the existing
+// file, so a failed write never leaves a truncated file behind. The context's
+// metadata is written to a <filename>.meta.json sidecar file.
+func (b *Local) Write(ctx context.Context, filename string, data io.Reader) error {
+	err := b.write(filename, data)
+	if err == nil {
+		err = b.writeMetadata(filename, MetadataFromContext(ctx))
+	}
 	if err != nil {
 		metrics.LocalError()
+	}
+	return err
+}
+
+func (b *Local) write(filename string, data io.Reader) (err error) {
+	path := b.path(filename)
+	dir := filepath.Dir(path)
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".*"+localTempSuffix)
+	if err != nil {
 		return err
 	}
 
 	defer func() {
-		err := f.Close()
 		if err != nil {
-			metrics.LocalError()
-			log.Errorf("%v", err)
+			_ = f.Close()
+			_ = os.Remove(f.Name())
 		}
 	}()
 
-	for {
-		n, err := data.Read(buf)
-		if err != nil && err != io.EOF {
-			metrics.LocalError()
-			return err
-		}
-		if n == 0 {
-			break
-		}
+	_, err = io.Copy(f, data)
+	if err != nil {
+		return err
+	}
+	err = f.Chmod(b.fileMode())
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
 
-		_, err = f.Write(buf[:n])
-		if err != nil {
-			metrics.LocalError()
-			return err
-		}
+	err = os.Rename(f.Name(), path)
+	if err != nil {
+		return err
 	}
-	return nil
+	return syncDir(dir)
+}
+
+// writeMetadata writes the file's metadata sidecar, or removes the sidecar
+// left by a previous write if there's no metadata
+func (b *Local) writeMetadata(filename string, metadata map[string]string) error {
+	if len(metadata) == 0 {
+		return b.removeMetadata(filename)
+	}
+
+	f, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return b.write(filename+localMetadataSuffix, bytes.NewReader(f))
+}
+
+func (b *Local) removeMetadata(filename string) error {
+	err := os.Remove(b.path(filename + localMetadataSuffix))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// syncDir persists the directory entry of a renamed file
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close() // nolint: errcheck
+	return d.Sync()
 }
 
 // Delete deletes the specified file from the backend
-func (b *Local) Delete(filename string) error {
+func (b *Local) Delete(ctx context.Context, filename string) error {
 	err := os.Remove(b.path(filename))
+	if err == nil {
+		err = b.removeMetadata(filename)
+	}
 	if err != nil {
 		metrics.LocalError()
 	}
@@ -83,7 +197,7 @@ func (b *Local) Delete(filename string) error {
 }
 
 // List lists all files in the specified path on the backend
-func (b *Local) List() (ret []string, err error) {
+func (b *Local) List(ctx context.Context) (ret []string, err error) {
 	files, err := ioutil.ReadDir(b.path(""))
 	if err != nil {
 		metrics.LocalError()
@@ -91,6 +205,9 @@ func (b *Local) List() (ret []string, err error) {
 	}
 
 	for _, file := range files {
+		if file.IsDir() || isInternalFile(file.Name()) {
+			continue
+		}
 		ret = append(ret, file.Name())
 	}
 	if err != nil {
@@ -99,6 +216,145 @@ func (b *Local) List() (ret []string, err error) {
 	return ret, err
 }
 
+// ListDetailed lists all files in the specified path on the backend along
+// with their metadata. Files aren't read, so the ETag is derived from the
+// modification time and size, and the sha256 digest isn't listed.
+func (b *Local) ListDetailed(ctx context.Context) (ret []*ObjectInfo, err error) {
+	files, err := ioutil.ReadDir(b.path(""))
+	if err != nil {
+		metrics.LocalError()
+		return nil, err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || isInternalFile(file.Name()) {
+			continue
+		}
+
+		ret = append(ret, &ObjectInfo{
+			Name:    file.Name(),
+			Size:    file.Size(),
+			ModTime: file.ModTime(),
+			ETag:    fmt.Sprintf("%x-%x", file.ModTime().UnixNano(), file.Size()),
+		})
+	}
+	return ret, nil
+}
+
+// ReadVersion opens the specified file from the backend for reading. The
+// version is the sha256 digest of the file's contents.
+func (b *Local) ReadVersion(ctx context.Context, filename string) (io.ReadCloser, string, error) {
+	f, err := ioutil.ReadFile(b.path(filename))
+	if err != nil {
+		metrics.LocalError()
+		return nil, "", err
+	}
+
+	sum := sha256.Sum256(f)
+	return ioutil.NopCloser(bytes.NewReader(f)), hex.EncodeToString(sum[:]), nil
+}
+
+// WriteIfMatch writes the contents to the specified path on the backend if
+// the file is still at the specified version. Writers sharing the directory
+// are serialized by a lock file so the check and the write are atomic.
+func (b *Local) WriteIfMatch(ctx context.Context, filename string, data io.Reader, version string) (string, error) {
+	unlock, err := b.lock(ctx, filename)
+	if err != nil {
+		metrics.LocalError()
+		return "", err
+	}
+	defer unlock()
+
+	current, err := b.sha256(filename)
+	if os.IsNotExist(err) {
+		current, err = "", nil
+	}
+	if err != nil {
+		metrics.LocalError()
+		return "", err
+	}
+	if current != version {
+		return "", ErrConflict
+	}
+
+	h := sha256.New()
+	err = b.Write(ctx, filename, io.TeeReader(data, h))
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// lock creates the lock file for the specified file, waiting for any other
+// holder to release it, and returns a func that releases the lock
+func (b *Local) lock(ctx context.Context, filename string) (func(), error) {
+	lockfile := b.path(filename + localLockSuffix)
+	for {
+		f, err := os.OpenFile(lockfile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, b.fileMode())
+		if err == nil {
+			_ = f.Close()
+			return func() {
+				err := os.Remove(lockfile)
+				if err != nil {
+					metrics.LocalError()
+					log.Errorf("%v", err)
+				}
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		info, err := os.Stat(lockfile)
+		if err == nil && time.Since(info.ModTime()) > localLockTimeout {
+			log.Warnf("Removing stale lock file %s", lockfile)
+			_ = os.Remove(lockfile)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("Timed out waiting for lock file %s: %v", lockfile, ctx.Err())
+		case <-time.After(localLockRetryInterval):
+		}
+	}
+}
+
+// isInternalFile returns true for lock, metadata and temporary files, which
+// aren't listed as stored files
+func isInternalFile(filename string) bool {
+	return strings.HasSuffix(filename, localLockSuffix) || strings.HasSuffix(filename, localMetadataSuffix) || strings.HasSuffix(filename, localTempSuffix)
+}
+
+func (b *Local) sha256(filename string) (string, error) {
+	f, err := os.Open(b.path(filename))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close() // nolint: errcheck
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (b *Local) fileMode() os.FileMode {
+	if b.Opts == nil || b.Opts.FileMode == 0 {
+		return DefaultLocalFileMode
+	}
+	return b.Opts.FileMode
+}
+
+func (b *Local) dirMode() os.FileMode {
+	if b.Opts == nil || b.Opts.DirMode == 0 {
+		return DefaultLocalDirMode
+	}
+	return b.Opts.DirMode
+}
+
 func (b *Local) path(filename string) string {
 	path, err := filepath.Abs(b.BackendConfig.StoragePath)
 	if err != nil {
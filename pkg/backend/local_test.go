@@ -0,0 +1,28 @@
+package backend_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend/backendtest"
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+)
+
+func TestLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	path := filepath.Join(dir, "releases")
+	backendtest.TestBackend(t, func(path string) backend.Backend {
+		return &backend.Local{
+			BackendConfig: &config.BackendConfig{StoragePath: path},
+			Opts:          &backend.LocalOpts{},
+		}
+	}, path, path+"/", filepath.Join(dir, "nested", "..", "releases"))
+}
@@ -0,0 +1,194 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+)
+
+// Memory implements the Backend interface by storing files in memory. It
+// follows the same path handling as the object store backends and is
+// intended for testing, so it isn't registered with a URL scheme.
+type Memory struct {
+	BackendConfig *config.BackendConfig
+	Opts          *MemoryOpts
+}
+
+// MemoryOpts represents the memory backend configuration options
+type MemoryOpts struct {
+	// Store holds the files. Backends sharing a store see each other's files,
+	// like backends sharing a bucket. A new store is created if it is nil.
+	Store *MemoryStore
+}
+
+// MemoryStore holds the files of one or more memory backends by object path
+type MemoryStore struct {
+	mu    sync.Mutex
+	files map[string]*memoryFile
+	// incremented on every write to version files
+	generation int64
+}
+
+type memoryFile struct {
+	data       []byte
+	generation int64
+	modTime    time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{files: map[string]*memoryFile{}}
+}
+
+// Init the backend
+func (b *Memory) Init(ctx context.Context) error {
+	if b.Opts == nil {
+		b.Opts = &MemoryOpts{}
+	}
+	if b.Opts.Store == nil {
+		b.Opts.Store = NewMemoryStore()
+	}
+	return nil
+}
+
+// Read opens the specified file from the backend for reading
+func (b *Memory) Read(ctx context.Context, filename string) (io.ReadCloser, error) {
+	r, _, err := b.ReadVersion(ctx, filename)
+	return r, err
+}
+
+// ReadVersion opens the specified file from the backend for reading. The
+// version is the store's generation when the file was written.
+func (b *Memory) ReadVersion(ctx context.Context, filename string) (io.ReadCloser, string, error) {
+	s := b.Opts.Store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.files[b.path(filename)]
+	if !ok {
+		return nil, "", b.notExist("read", filename)
+	}
+	return ioutil.NopCloser(bytes.NewReader(f.data)), strconv.FormatInt(f.generation, 10), nil
+}
+
+// Config returns the backend's config
+func (b *Memory) Config() *config.BackendConfig {
+	return b.BackendConfig
+}
+
+// Writes the contents to the specified path on the backend
+func (b *Memory) Write(ctx context.Context, filename string, data io.Reader) error {
+	f, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+
+	s := b.Opts.Store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b.store(filename, f)
+	return nil
+}
+
+// WriteIfMatch writes the contents to the specified path on the backend if
+// the stored file is still at the specified version
+func (b *Memory) WriteIfMatch(ctx context.Context, filename string, data io.Reader, version string) (string, error) {
+	f, err := ioutil.ReadAll(data)
+	if err != nil {
+		return "", err
+	}
+
+	s := b.Opts.Store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := ""
+	if existing, ok := s.files[b.path(filename)]; ok {
+		current = strconv.FormatInt(existing.generation, 10)
+	}
+	if current != version {
+		return "", ErrConflict
+	}
+	return strconv.FormatInt(b.store(filename, f), 10), nil
+}
+
+// Delete deletes the specified file from the backend
+func (b *Memory) Delete(ctx context.Context, filename string) error {
+	s := b.Opts.Store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.files[b.path(filename)]; !ok {
+		return b.notExist("remove", filename)
+	}
+	delete(s.files, b.path(filename))
+	return nil
+}
+
+// List lists all files in the specified path on the backend
+func (b *Memory) List(ctx context.Context) ([]string, error) {
+	objects, err := b.ListDetailed(ctx)
+	return names(objects), err
+}
+
+// ListDetailed lists all files in the specified path on the backend along
+// with their metadata
+func (b *Memory) ListDetailed(ctx context.Context) (ret []*ObjectInfo, err error) {
+	s := b.Opts.Store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := b.path("")
+	for key, f := range s.files {
+		name := strings.TrimPrefix(key, path)
+		// like a delimited object listing, skip files in nested paths
+		if !strings.HasPrefix(key, path) || strings.Contains(name, delimiter) {
+			continue
+		}
+
+		sum := sha256.Sum256(f.data)
+		ret = append(ret, &ObjectInfo{
+			Name:    name,
+			Size:    int64(len(f.data)),
+			ModTime: f.modTime,
+			ETag:    hex.EncodeToString(sum[:]),
+			SHA256:  hex.EncodeToString(sum[:]),
+		})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
+
+// store writes the file and returns its generation. The store must be locked.
+func (b *Memory) store(filename string, data []byte) int64 {
+	s := b.Opts.Store
+	s.generation++
+	s.files[b.path(filename)] = &memoryFile{
+		data:       data,
+		generation: s.generation,
+		modTime:    time.Now(),
+	}
+	return s.generation
+}
+
+func (b *Memory) notExist(op string, filename string) error {
+	return &os.PathError{Op: op, Path: b.path(filename), Err: os.ErrNotExist}
+}
+
+func (b *Memory) path(filename string) string {
+	return objectPath(b.BackendConfig.StoragePath, filename)
+}
@@ -0,0 +1,29 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend/backendtest"
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+)
+
+func TestMemory(t *testing.T) {
+	store := backend.NewMemoryStore()
+	backendtest.TestBackend(t, func(path string) backend.Backend {
+		return &backend.Memory{
+			BackendConfig: &config.BackendConfig{StoragePath: path},
+			Opts:          &backend.MemoryOpts{Store: store},
+		}
+	}, "releases", "/releases/")
+}
+
+func TestMemoryDistinctPaths(t *testing.T) {
+	store := backend.NewMemoryStore()
+	backendtest.TestDistinctPaths(t, func(path string) backend.Backend {
+		return &backend.Memory{
+			BackendConfig: &config.BackendConfig{StoragePath: path},
+			Opts:          &backend.MemoryOpts{Store: store},
+		}
+	}, "/", "//a/", "/a/", "a//")
+}
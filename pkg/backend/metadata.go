@@ -0,0 +1,40 @@
+package backend
+
+import (
+	"context"
+)
+
+// Metadata keys describing stored release files
+const (
+	MetadataChart        = "chart"
+	MetadataChartVersion = "chart-version"
+	MetadataCluster      = "cluster"
+	MetadataNamespace    = "namespace"
+	MetadataRelease      = "release"
+	MetadataRevision     = "revision"
+)
+
+type metadataKey struct{}
+
+// WithMetadata returns a context carrying metadata that backends attach to
+// the files written with it, e.g. as S3 object metadata and tags. The
+// metadata is merged with any metadata the context already carries.
+// Metadata is passed in the context so it reaches the storage backend
+// through any decorators unchanged.
+func WithMetadata(ctx context.Context, metadata map[string]string) context.Context {
+	merged := map[string]string{}
+	for k, v := range MetadataFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range metadata {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, metadataKey{}, merged)
+}
+
+// MetadataFromContext returns the metadata to attach to files written with
+// the context, if any
+func MetadataFromContext(ctx context.Context) map[string]string {
+	metadata, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return metadata
+}
@@ -0,0 +1,239 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+	"github.com/logicmonitor/k8s-release-manager/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// MirrorConsistencyAll requires writes and deletes to succeed on every target
+	MirrorConsistencyAll = "all"
+	// MirrorConsistencyBestEffort requires writes and deletes to succeed on at least one target
+	MirrorConsistencyBestEffort = "best-effort"
+)
+
+// Mirror implements the Backend interface by writing and deleting files on
+// several backends at once. Files are read and listed from the first target
+// that responds successfully, so the targets should be listed in order of
+// preference.
+type Mirror struct {
+	Consistency string
+	Targets     []*MirrorTarget
+}
+
+// MirrorTarget is a named backend written to by a Mirror
+type MirrorTarget struct {
+	Backend Backend
+	// Name identifies the target in logs and metrics
+	Name string
+}
+
+// Init the backend
+func (b *Mirror) Init(ctx context.Context) error {
+	if len(b.Targets) == 0 {
+		return fmt.Errorf("No mirror targets are configured")
+	}
+	switch b.Consistency {
+	case MirrorConsistencyAll, MirrorConsistencyBestEffort:
+	default:
+		return fmt.Errorf("Unsupported mirror consistency %s", b.Consistency)
+	}
+
+	return b.each(func(t *MirrorTarget) error {
+		return t.Backend.Init(ctx)
+	})
+}
+
+// Read opens the specified file from the first target that can read it
+func (b *Mirror) Read(ctx context.Context, filename string) (ret io.ReadCloser, err error) {
+	err = b.first(func(t *MirrorTarget) (err error) {
+		ret, err = t.Backend.Read(ctx, filename)
+		return err
+	})
+	return ret, err
+}
+
+// ReadVersion opens the specified file from the first target, which is used
+// to detect concurrent writers, and returns the version of the stored file
+func (b *Mirror) ReadVersion(ctx context.Context, filename string) (io.ReadCloser, string, error) {
+	cw, ok := b.Targets[0].Backend.(ConditionalWriter)
+	if !ok {
+		return nil, "", ErrConditionalWriteUnsupported
+	}
+	return cw.ReadVersion(ctx, filename)
+}
+
+// Config returns the config of the first target
+func (b *Mirror) Config() *config.BackendConfig {
+	return b.Targets[0].Backend.Config()
+}
+
+// Writes the contents to the specified path on every target. The contents
+// are buffered in memory since each target consumes them separately.
+func (b *Mirror) Write(ctx context.Context, filename string, data io.Reader) error {
+	f, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+
+	return b.each(func(t *MirrorTarget) error {
+		return t.Backend.Write(ctx, filename, bytes.NewReader(f))
+	})
+}
+
+// WriteIfMatch writes the contents to the first target if the stored file is
+// still at the specified version, then to the remaining targets
+func (b *Mirror) WriteIfMatch(ctx context.Context, filename string, data io.Reader, version string) (string, error) {
+	cw, ok := b.Targets[0].Backend.(ConditionalWriter)
+	if !ok {
+		return "", ErrConditionalWriteUnsupported
+	}
+
+	f, err := ioutil.ReadAll(data)
+	if err != nil {
+		return "", err
+	}
+
+	version, err = cw.WriteIfMatch(ctx, filename, bytes.NewReader(f), version)
+	if err != nil {
+		b.targetError(b.Targets[0], err)
+		return "", err
+	}
+
+	mirror := &Mirror{Consistency: b.Consistency, Targets: b.Targets[1:]}
+	if len(mirror.Targets) == 0 {
+		return version, nil
+	}
+	return version, mirror.each(func(t *MirrorTarget) error {
+		return t.Backend.Write(ctx, filename, bytes.NewReader(f))
+	})
+}
+
+// Delete deletes the specified file from every target. Targets that don't
+// have the file, e.g. mirrors added after it was written, succeed.
+func (b *Mirror) Delete(ctx context.Context, filename string) error {
+	return b.each(func(t *MirrorTarget) error {
+		err := t.Backend.Delete(ctx, filename)
+		if os.IsNotExist(err) || errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	})
+}
+
+// List lists all files in the specified path on the first target that can
+// list them
+func (b *Mirror) List(ctx context.Context) (ret []string, err error) {
+	err = b.first(func(t *MirrorTarget) (err error) {
+		ret, err = t.Backend.List(ctx)
+		return err
+	})
+	return ret, err
+}
+
+// ListDetailed lists all files in the specified path on the first target
+// that can list them along with their metadata
+func (b *Mirror) ListDetailed(ctx context.Context) (ret []*ObjectInfo, err error) {
+	err = b.first(func(t *MirrorTarget) (err error) {
+		ret, err = t.Backend.ListDetailed(ctx)
+		return err
+	})
+	return ret, err
+}
+
+// each calls f for every target concurrently and returns an error according
+// to the configured consistency
+func (b *Mirror) each(f func(*MirrorTarget) error) error {
+	errs := make([]error, len(b.Targets))
+	var wg sync.WaitGroup
+	for i, t := range b.Targets {
+		wg.Add(1)
+		go func(i int, t *MirrorTarget) {
+			defer wg.Done()
+			errs[i] = f(t)
+		}(i, t)
+	}
+	wg.Wait()
+
+	failed := &MirrorError{}
+	for i, err := range errs {
+		if err != nil {
+			b.targetError(b.Targets[i], err)
+			failed.Targets = append(failed.Targets, b.Targets[i].Name)
+			failed.Errors = append(failed.Errors, err)
+		}
+	}
+
+	switch {
+	case len(failed.Errors) == 0:
+		return nil
+	case b.Consistency == MirrorConsistencyBestEffort && len(failed.Errors) < len(b.Targets):
+		return nil
+	default:
+		return failed
+	}
+}
+
+// MirrorError reports the targets that failed a mirrored operation. It
+// matches the errors of every failed target with errors.Is and errors.As,
+// e.g. ErrRetained if any target retained a deleted file.
+type MirrorError struct {
+	Targets []string
+	Errors  []error
+}
+
+func (e *MirrorError) Error() string {
+	var msgs []string
+	for i, err := range e.Errors {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", e.Targets[i], err))
+	}
+	return fmt.Sprintf("Mirror targets failed: %s", strings.Join(msgs, "; "))
+}
+
+// Is returns true if any target's error matches the target error
+func (e *MirrorError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first target's error that matches the target type
+func (e *MirrorError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// first calls f for each target in order until it succeeds
+func (b *Mirror) first(f func(*MirrorTarget) error) (err error) {
+	for _, t := range b.Targets {
+		err = f(t)
+		if err == nil {
+			return nil
+		}
+		b.targetError(t, err)
+	}
+	return err
+}
+
+func (b *Mirror) targetError(t *MirrorTarget, err error) {
+	metrics.MirrorError(t.Name)
+	log.Warnf("Mirror target %s failed: %v", t.Name, err)
+}
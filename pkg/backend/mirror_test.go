@@ -0,0 +1,84 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+)
+
+func TestMirrorDeleteMissingOnTarget(t *testing.T) {
+	ctx := context.Background()
+	primary := &Memory{BackendConfig: &config.BackendConfig{StoragePath: "primary"}}
+	dir, err := ioutil.TempDir("", "mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	local := &Local{BackendConfig: &config.BackendConfig{StoragePath: dir}}
+	b := &Mirror{
+		Consistency: MirrorConsistencyAll,
+		Targets:     []*MirrorTarget{{Backend: primary, Name: "primary"}, {Backend: local, Name: "local"}},
+	}
+	err = b.Init(ctx)
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	// stored before the mirror was added
+	err = primary.Write(ctx, "old.release", strings.NewReader("old"))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	err = b.Delete(ctx, "old.release")
+	if err != nil {
+		t.Fatalf("Delete of a file missing on a mirror target: %v", err)
+	}
+	files, err := primary.List(ctx)
+	if err != nil || len(files) != 0 {
+		t.Fatalf("primary lists %v, %v after Delete, want no files", files, err)
+	}
+}
+
+// retaining refuses to delete files like a bucket with Object Lock
+type retaining struct {
+	*Memory
+}
+
+func (b retaining) Delete(ctx context.Context, filename string) error {
+	return &RetentionError{Filename: filename}
+}
+
+func TestMirrorDeleteRetained(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	b := &Mirror{
+		Consistency: MirrorConsistencyAll,
+		Targets: []*MirrorTarget{
+			{Backend: &Memory{BackendConfig: &config.BackendConfig{StoragePath: "primary"}, Opts: &MemoryOpts{Store: store}}, Name: "primary"},
+			{Backend: retaining{&Memory{BackendConfig: &config.BackendConfig{StoragePath: "locked"}, Opts: &MemoryOpts{Store: store}}}, Name: "locked"},
+		},
+	}
+	err := b.Init(ctx)
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	err = b.Write(ctx, "a.release", strings.NewReader("a"))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	err = b.Delete(ctx, "a.release")
+	if !errors.Is(err, ErrRetained) {
+		t.Fatalf("Delete of a retained file returned %v, want %v", err, ErrRetained)
+	}
+	var retained *RetentionError
+	if !errors.As(err, &retained) || retained.Filename != "a.release" {
+		t.Fatalf("Delete of a retained file returned %v, want a RetentionError for a.release", err)
+	}
+}
@@ -0,0 +1,146 @@
+package backend
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+)
+
+// Factory returns the backend for a backend URL. The URL's path has already
+// been set as the config's storage path, and the query holds the backend's
+// options.
+type Factory func(u *url.URL, cfg *config.BackendConfig) (Backend, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{}
+)
+
+// Register makes a backend available by URL scheme. It panics if the scheme
+// is already registered.
+func Register(scheme string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if _, ok := factories[scheme]; ok {
+		panic("backend: Register called twice for scheme " + scheme)
+	}
+	factories[scheme] = factory
+}
+
+// Schemes returns the registered URL schemes in sorted order
+func Schemes() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	var ret []string
+	for scheme := range factories {
+		ret = append(ret, scheme)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// FromURL returns the backend for the URL, e.g.
+// s3://bucket/path?region=us-west-2 or file:///var/backups. The URL's path is
+// set as cfg's storage path. The backend must be initialized before use.
+func FromURL(rawurl string, cfg *config.BackendConfig) (Backend, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	factoriesMu.RLock()
+	factory, ok := factories[u.Scheme]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unsupported backend scheme %q in %s, expected one of %s", u.Scheme, rawurl, strings.Join(Schemes(), ", "))
+	}
+
+	cfg.StoragePath = u.Path
+	return factory(u, cfg)
+}
+
+// queryBool returns the boolean value of the URL query parameter, or false if
+// it isn't set
+func queryBool(u *url.URL, key string) (bool, error) {
+	v := u.Query().Get(key)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("Invalid value %q for %s in backend URL", v, key)
+	}
+	return b, nil
+}
+
+// requireHost returns an error if the URL has no host, which names the bucket,
+// container or namespace for most backends
+func requireHost(u *url.URL, name string) error {
+	if u.Host == "" {
+		return fmt.Errorf("The %s backend URL must include the %s, e.g. %s://<%s>/path", u.Scheme, name, u.Scheme, name)
+	}
+	return nil
+}
+
+// Location returns a normalized URL identifying where the backend stores its
+// files, i.e. its scheme, bucket or host, and the prefix of its object keys,
+// so two backends configured differently for the same files have the same
+// location. It returns an empty string if the backend's
+// location is unknown.
+func Location(b Backend) string {
+	var scheme, host string
+	q := url.Values{}
+	switch b := b.(type) {
+	case *Retrying:
+		return Location(b.Backend)
+	case *Local:
+		path, err := filepath.Abs(b.BackendConfig.StoragePath)
+		if err != nil {
+			return ""
+		}
+		return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+	case *S3:
+		scheme, host = "s3", b.Opts.Bucket
+		if b.Opts.Endpoint != nil && b.Opts.Endpoint.URL != "" {
+			q.Set("endpoint", strings.TrimRight(b.Opts.Endpoint.URL, delimiter))
+		}
+	case *GCS:
+		scheme, host = "gs", b.Opts.Bucket
+		if b.Opts.Endpoint != "" {
+			q.Set("endpoint", strings.TrimRight(b.Opts.Endpoint, delimiter))
+		}
+	case *Azure:
+		scheme, host = "azblob", b.Opts.Container
+		q.Set("account", b.Opts.Account)
+		if b.Opts.Endpoint != "" {
+			q.Set("endpoint", strings.TrimRight(b.Opts.Endpoint, delimiter))
+		}
+	case *Kubernetes:
+		scheme, host = "kubernetes", b.Opts.Namespace
+		q.Set("kind", b.Opts.Kind)
+		if b.Opts.KubeContext != "" {
+			q.Set("kubecontext", b.Opts.KubeContext)
+		}
+	case *Memory:
+		if b.Opts == nil || b.Opts.Store == nil {
+			return ""
+		}
+		scheme, host = "memory", fmt.Sprintf("%p", b.Opts.Store)
+	default:
+		return ""
+	}
+
+	u := &url.URL{
+		Scheme:   scheme,
+		Host:     strings.ToLower(host),
+		Path:     delimiter + objectPath(b.Config().StoragePath, ""),
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
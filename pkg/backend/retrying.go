@@ -0,0 +1,288 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+	"github.com/logicmonitor/k8s-release-manager/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Retrying implements the Backend interface by wrapping another Backend and
+// retrying operations that fail with transient errors, waiting an
+// exponentially increasing, randomly jittered, interval between attempts.
+type Retrying struct {
+	Backend Backend
+	Opts    *config.RetryConfig
+}
+
+// Init the backend
+func (b *Retrying) Init(ctx context.Context) error {
+	return b.Backend.Init(ctx)
+}
+
+// Read opens the specified file from the backend for reading. Only opening
+// the file is retried.
+func (b *Retrying) Read(ctx context.Context, filename string) (ret io.ReadCloser, err error) {
+	err = b.do(ctx, fmt.Sprintf("read %s", filename), func() (err error) {
+		ret, err = b.Backend.Read(ctx, filename)
+		return err
+	})
+	return ret, err
+}
+
+// ReadVersion opens the specified file from the backend for reading and
+// returns the version of the stored file
+func (b *Retrying) ReadVersion(ctx context.Context, filename string) (ret io.ReadCloser, version string, err error) {
+	cw, ok := b.Backend.(ConditionalWriter)
+	if !ok {
+		return nil, "", ErrConditionalWriteUnsupported
+	}
+
+	err = b.do(ctx, fmt.Sprintf("read %s", filename), func() (err error) {
+		ret, version, err = cw.ReadVersion(ctx, filename)
+		return err
+	})
+	return ret, version, err
+}
+
+// Config returns the backend's config
+func (b *Retrying) Config() *config.BackendConfig {
+	return b.Backend.Config()
+}
+
+// Writes the contents to the specified path on the backend. Contents that
+// can't be rewound for another attempt are buffered in memory.
+func (b *Retrying) Write(ctx context.Context, filename string, data io.Reader) error {
+	r, err := rewindable(data)
+	if err != nil {
+		return err
+	}
+
+	return b.do(ctx, fmt.Sprintf("write %s", filename), func() error {
+		err := r.rewind()
+		if err != nil {
+			return err
+		}
+		return b.Backend.Write(ctx, filename, r)
+	})
+}
+
+// WriteIfMatch writes the contents to the specified path on the backend if
+// the stored file is still at the specified version. An attempt that failed
+// ambiguously, e.g. with a timeout, may have written the file anyway, in which
+// case the retry conflicts with it. A conflicting retry succeeds if the stored
+// file is identical to the contents.
+func (b *Retrying) WriteIfMatch(ctx context.Context, filename string, data io.Reader, version string) (ret string, err error) {
+	cw, ok := b.Backend.(ConditionalWriter)
+	if !ok {
+		return "", ErrConditionalWriteUnsupported
+	}
+
+	r, err := rewindable(data)
+	if err != nil {
+		return "", err
+	}
+
+	attempts := 0
+	err = b.do(ctx, fmt.Sprintf("write %s", filename), func() (err error) {
+		attempts++
+		err = r.rewind()
+		if err != nil {
+			return err
+		}
+		ret, err = cw.WriteIfMatch(ctx, filename, r, version)
+		return err
+	})
+	if attempts > 1 && errors.Is(err, ErrConflict) {
+		if v, ok := b.written(ctx, cw, filename, r); ok {
+			log.Warnf("Retried write of %s conflicted with an earlier attempt that succeeded", filename)
+			return v, nil
+		}
+	}
+	return ret, err
+}
+
+// written returns the version of the stored file if its contents are identical
+// to the contents that were written
+func (b *Retrying) written(ctx context.Context, cw ConditionalWriter, filename string, r *rewindableReader) (string, bool) {
+	err := r.rewind()
+	if err != nil {
+		return "", false
+	}
+	want, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", false
+	}
+
+	rc, version, err := cw.ReadVersion(ctx, filename)
+	if err != nil {
+		return "", false
+	}
+	defer rc.Close() // nolint: errcheck
+	stored, err := ioutil.ReadAll(rc)
+	if err != nil || !bytes.Equal(stored, want) {
+		return "", false
+	}
+	return version, true
+}
+
+// Delete deletes the specified file from the backend
+func (b *Retrying) Delete(ctx context.Context, filename string) error {
+	return b.do(ctx, fmt.Sprintf("delete %s", filename), func() error {
+		return b.Backend.Delete(ctx, filename)
+	})
+}
+
+// List lists all files in the specified path on the backend
+func (b *Retrying) List(ctx context.Context) (ret []string, err error) {
+	err = b.do(ctx, "list files", func() (err error) {
+		ret, err = b.Backend.List(ctx)
+		return err
+	})
+	return ret, err
+}
+
+// ListDetailed lists all files in the specified path on the backend along
+// with their metadata
+func (b *Retrying) ListDetailed(ctx context.Context) (ret []*ObjectInfo, err error) {
+	err = b.do(ctx, "list files", func() (err error) {
+		ret, err = b.Backend.ListDetailed(ctx)
+		return err
+	})
+	return ret, err
+}
+
+// do calls f until it succeeds, fails with an error that isn't retryable,
+// the maximum number of attempts is reached or the context is done
+func (b *Retrying) do(ctx context.Context, op string, f func() error) error {
+	backoff := b.Opts.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		metrics.BackendAttempt()
+		err := f()
+		if err == nil {
+			return nil
+		}
+
+		metrics.BackendAttemptError()
+		if attempt >= b.Opts.MaxAttempts || ctx.Err() != nil || !Retryable(err) {
+			return err
+		}
+
+		// full jitter spreads out the retries of concurrent operations
+		delay := time.Duration(rand.Int63n(int64(backoff) + 1)) // nolint: gosec
+		log.Warnf("Attempt %d of %d to %s failed. Retrying in %s: %v", attempt, b.Opts.MaxAttempts, op, delay, err)
+		metrics.BackendRetry()
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+
+		backoff *= 2
+		if backoff > b.Opts.MaxBackoff {
+			backoff = b.Opts.MaxBackoff
+		}
+	}
+}
+
+// Retryable returns true if the error is likely to be transient, e.g. a
+// network error, throttling or a server error
+func Retryable(err error) bool {
+	switch {
+	case errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, ErrConflict),
+		errors.Is(err, ErrConditionalWriteUnsupported),
+		os.IsNotExist(err),
+		os.IsPermission(err):
+		return false
+	// e.g. NFS hiccups
+	case errors.Is(err, syscall.EIO),
+		errors.Is(err, syscall.ESTALE),
+		errors.Is(err, syscall.EAGAIN),
+		errors.Is(err, syscall.EBUSY),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var awsErr awserr.RequestFailure
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		case "SlowDown", "Throttling", "ThrottlingException", "RequestTimeout", "InternalError":
+			return true
+		}
+		return retryableStatus(awsErr.StatusCode())
+	}
+
+	var gcsErr *googleapi.Error
+	if errors.As(err, &gcsErr) {
+		return retryableStatus(gcsErr.Code)
+	}
+
+	var azureErr azblob.StorageError
+	if errors.As(err, &azureErr) && azureErr.Response() != nil {
+		return retryableStatus(azureErr.Response().StatusCode)
+	}
+
+	return kerrors.IsTooManyRequests(err) ||
+		kerrors.IsServerTimeout(err) ||
+		kerrors.IsTimeout(err) ||
+		kerrors.IsInternalError(err) ||
+		kerrors.IsServiceUnavailable(err)
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= http.StatusInternalServerError
+}
+
+// rewindableReader is a reader that can be rewound to its starting position
+type rewindableReader struct {
+	io.ReadSeeker
+	start int64
+}
+
+func (r *rewindableReader) rewind() error {
+	_, err := r.Seek(r.start, io.SeekStart)
+	return err
+}
+
+// rewindable returns a reader for the contents that can be rewound to the
+// current position, buffering the contents if the reader can't seek
+func rewindable(data io.Reader) (*rewindableReader, error) {
+	if rs, ok := data.(io.ReadSeeker); ok {
+		start, err := rs.Seek(0, io.SeekCurrent)
+		if err == nil {
+			return &rewindableReader{ReadSeeker: rs, start: start}, nil
+		}
+	}
+
+	buf, err := ioutil.ReadAll(data)
+	if err != nil {
+		return nil, err
+	}
+	return &rewindableReader{ReadSeeker: bytes.NewReader(buf)}, nil
+}
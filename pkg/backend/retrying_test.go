@@ -0,0 +1,59 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+)
+
+// lostResponse writes the file but fails the first conditional write as if
+// the connection was reset before the response arrived
+type lostResponse struct {
+	*Memory
+	failed bool
+}
+
+func (b *lostResponse) WriteIfMatch(ctx context.Context, filename string, data io.Reader, version string) (string, error) {
+	v, err := b.Memory.WriteIfMatch(ctx, filename, data, version)
+	if err == nil && !b.failed {
+		b.failed = true
+		return "", syscall.ECONNRESET
+	}
+	return v, err
+}
+
+func TestRetryingWriteIfMatch(t *testing.T) {
+	ctx := context.Background()
+	inner := &lostResponse{Memory: &Memory{BackendConfig: &config.BackendConfig{StoragePath: "retrying"}}}
+	b := &Retrying{Backend: inner, Opts: &config.RetryConfig{MaxAttempts: 3}}
+	err := b.Init(ctx)
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	version, err := b.WriteIfMatch(ctx, "state", strings.NewReader("first"), "")
+	if err != nil {
+		t.Fatalf("WriteIfMatch after a lost response: %v", err)
+	}
+
+	rc, stored, err := b.ReadVersion(ctx, "state")
+	if err != nil {
+		t.Fatalf("ReadVersion: %v", err)
+	}
+	defer rc.Close() // nolint: errcheck
+	data, _ := ioutil.ReadAll(rc)
+	if string(data) != "first" || stored != version {
+		t.Fatalf("stored %q at version %q, want %q at version %q", data, stored, "first", version)
+	}
+
+	_, err = b.WriteIfMatch(ctx, "state", strings.NewReader("second"), "stale")
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("WriteIfMatch with a stale version returned %v, want %v", err, ErrConflict)
+	}
+}
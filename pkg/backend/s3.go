@@ -1,63 +1,258 @@
 package backend
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/logicmonitor/k8s-release-manager/pkg/config"
 	"github.com/logicmonitor/k8s-release-manager/pkg/metrics"
 )
 
 const (
-	delimiter = "/"
+	s3DefaultRoleSessionName = "releasemanager"
+	s3MaxTagValueLen         = 256
+	// temporary credentials are refreshed this long before they expire
+	s3CredentialsExpiryWindow = 5 * time.Minute
 )
 
 // S3 implements the Backend interface
 type S3 struct {
 	BackendConfig *config.BackendConfig
 	Opts          *S3Opts
+	httpClient    *http.Client
 	svc           *s3.S3
 }
 
 // S3Opts represents the S3 backend configuration options
 type S3Opts struct {
-	Auth   *S3Auth
-	Bucket string
-	Region string
+	Auth       *S3Auth
+	Bucket     string
+	Encryption *S3Encryption
+	Endpoint   *S3Endpoint
+	Region     string
+	// Retention is the Object Lock retention applied to uploaded releases
+	Retention *S3Retention
+	// StorageClass is the storage class of uploaded releases, e.g.
+	// STANDARD_IA, otherwise the bucket's default
+	StorageClass string
+	// Tagging attaches the written files' metadata as object tags, which
+	// requires the s3:PutObjectTagging permission
+	Tagging bool
+}
+
+// S3Encryption represents the S3 backend server-side encryption configuration options
+type S3Encryption struct {
+	// CustomerKey is the base64 encoded 256-bit key used for SSE-C
+	CustomerKey          string
+	KMSEncryptionContext map[string]string
+	KMSKeyID             string
+	// ServerSideEncryption is either AES256 for SSE-S3 or aws:kms for SSE-KMS
+	ServerSideEncryption string
+}
+
+// S3Retention represents the S3 Object Lock retention configuration options
+type S3Retention struct {
+	// Mode is either GOVERNANCE or COMPLIANCE
+	Mode   string
+	Period time.Duration
+}
+
+// S3Endpoint represents the configuration options for S3-compatible endpoints
+type S3Endpoint struct {
+	CABundle           string
+	ForcePathStyle     bool
+	InsecureSkipVerify bool
+	URL                string
 }
 
 // S3Auth represents the S3 backend authentication configuration options
 type S3Auth struct {
-	AccessKeyID     string
+	AccessKeyID string
+	// ExternalID is passed when assuming RoleARN, as required by some
+	// cross-account roles. It can't be used with WebIdentityTokenFile.
+	ExternalID string
+	// Profile is the named profile in the shared AWS config and credentials
+	// files used instead of the default credential provider chain
+	Profile         string
+	RoleARN         string
+	RoleSessionName string
 	SecretAccessKey string
 	SessionToken    string
+	// WebIdentityTokenFile is the OIDC token, e.g. a projected service
+	// account token, exchanged for the credentials of RoleARN
+	WebIdentityTokenFile string
+}
+
+func init() {
+	Register("s3", newS3FromURL)
+}
+
+// newS3FromURL returns the S3 backend for s3://bucket/path. The query sets the
+// region, endpoint, forcePathStyle, caBundle, insecureSkipVerify, sse and
+// sseKMSKeyID, storageClass, objectLockMode, objectLockRetentionDays and
+// tagging options, and the profile, roleARN, externalID, roleSessionName
+// and webIdentityTokenFile credential options. Credentials otherwise come
+// from the default AWS credential provider chain.
+func newS3FromURL(u *url.URL, cfg *config.BackendConfig) (Backend, error) {
+	err := requireHost(u, "bucket")
+	if err != nil {
+		return nil, err
+	}
+	forcePathStyle, err := queryBool(u, "forcePathStyle")
+	if err != nil {
+		return nil, err
+	}
+	insecureSkipVerify, err := queryBool(u, "insecureSkipVerify")
+	if err != nil {
+		return nil, err
+	}
+	tagging, err := queryBool(u, "tagging")
+	if err != nil {
+		return nil, err
+	}
+
+	retention := &S3Retention{Mode: u.Query().Get("objectLockMode")}
+	if days := u.Query().Get("objectLockRetentionDays"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("objectLockRetentionDays must be a positive number of days")
+		}
+		retention.Period = time.Duration(n) * 24 * time.Hour
+	}
+	if (retention.Mode == "") != (retention.Period == 0) {
+		return nil, fmt.Errorf("objectLockMode and objectLockRetentionDays must be set together")
+	}
+
+	q := u.Query()
+	if q.Get("caBundle") != "" && insecureSkipVerify {
+		return nil, fmt.Errorf("caBundle and insecureSkipVerify are mutually exclusive")
+	}
+	if q.Get("roleARN") == "" && (q.Get("externalID") != "" || q.Get("roleSessionName") != "" || q.Get("webIdentityTokenFile") != "") {
+		return nil, fmt.Errorf("externalID, roleSessionName and webIdentityTokenFile require roleARN")
+	}
+	if q.Get("externalID") != "" && q.Get("webIdentityTokenFile") != "" {
+		return nil, fmt.Errorf("externalID and webIdentityTokenFile are mutually exclusive")
+	}
+	region := q.Get("region")
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &S3{
+		BackendConfig: cfg,
+		Opts: &S3Opts{
+			Auth: &S3Auth{
+				ExternalID:           q.Get("externalID"),
+				Profile:              q.Get("profile"),
+				RoleARN:              q.Get("roleARN"),
+				RoleSessionName:      q.Get("roleSessionName"),
+				WebIdentityTokenFile: q.Get("webIdentityTokenFile"),
+			},
+			Bucket: u.Host,
+			Encryption: &S3Encryption{
+				KMSKeyID:             q.Get("sseKMSKeyID"),
+				ServerSideEncryption: q.Get("sse"),
+			},
+			Endpoint: &S3Endpoint{
+				CABundle:           q.Get("caBundle"),
+				ForcePathStyle:     forcePathStyle,
+				InsecureSkipVerify: insecureSkipVerify,
+				URL:                q.Get("endpoint"),
+			},
+			Region:       region,
+			Retention:    retention,
+			StorageClass: q.Get("storageClass"),
+			Tagging:      tagging,
+		},
+	}, nil
 }
 
 // Init the backend
-func (b *S3) Init() error {
+func (b *S3) Init(ctx context.Context) error {
+	if b.Opts.Endpoint.CABundle != "" || b.Opts.Endpoint.InsecureSkipVerify {
+		tlsConfig := &tls.Config{
+			InsecureSkipVerify: b.Opts.Endpoint.InsecureSkipVerify, // nolint: gosec
+		}
+		if b.Opts.Endpoint.CABundle != "" {
+			pool, err := caBundlePool(b.Opts.Endpoint.CABundle)
+			if err != nil {
+				return err
+			}
+			tlsConfig.RootCAs = pool
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		b.httpClient = &http.Client{Transport: transport}
+	}
+
+	svc, err := b.newClient()
+	if err != nil {
+		return err
+	}
+	b.svc = svc
 	return nil
 }
 
-// Read reads the specified file from the backend
-func (b *S3) Read(filename string) ([]byte, error) {
-	buf := aws.NewWriteAtBuffer([]byte{})
+// Read opens the specified file from the backend for reading
+func (b *S3) Read(ctx context.Context, filename string) (io.ReadCloser, error) {
+	result, err := b.getObject(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	return result.Body, nil
+}
+
+// ReadVersion opens the specified file from the backend for reading. The
+// version is the object's ETag.
+func (b *S3) ReadVersion(ctx context.Context, filename string) (io.ReadCloser, string, error) {
+	result, err := b.getObject(ctx, filename)
+	if err != nil {
+		return nil, "", err
+	}
+	return result.Body, strings.Trim(aws.StringValue(result.ETag), `"`), nil
+}
 
-	downloader := s3manager.NewDownloaderWithClient(b.client())
-	_, err := downloader.Download(buf, &s3.GetObjectInput{
+func (b *S3) getObject(ctx context.Context, filename string) (*s3.GetObjectOutput, error) {
+	input := &s3.GetObjectInput{
 		Bucket: aws.String(b.Opts.Bucket),
 		Key:    aws.String(b.path(filename)),
-	})
+	}
+
+	// objects encrypted with SSE-C can only be read with the same key
+	if b.Opts.Encryption.CustomerKey != "" {
+		key, err := base64.StdEncoding.DecodeString(b.Opts.Encryption.CustomerKey)
+		if err != nil {
+			return nil, b.checkError(err)
+		}
+		input.SSECustomerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+		input.SSECustomerKey = aws.String(string(key))
+	}
+
+	result, err := b.client().GetObjectWithContext(ctx, input)
 	if err != nil {
 		return nil, b.checkError(err)
 	}
-	return buf.Bytes(), nil
+	return result, nil
 }
 
 // Config returns the backend's config
@@ -66,22 +261,67 @@ func (b *S3) Config() *config.BackendConfig {
 }
 
 // Writes the contents to the specified path on the backend
-func (b *S3) Write(filename string, data io.Reader) error {
-	uploader := s3manager.NewUploaderWithClient(b.client())
-	_, err := uploader.Upload(&s3manager.UploadInput{
+func (b *S3) Write(ctx context.Context, filename string, data io.Reader) error {
+	return b.upload(ctx, filename, data)
+}
+
+// WriteIfMatch writes the contents to the specified path on the backend using
+// an If-Match (or If-None-Match for new files) precondition on the ETag. The
+// precondition is only applied to single part uploads, which is sufficient
+// for small files like the manager state.
+func (b *S3) WriteIfMatch(ctx context.Context, filename string, data io.Reader, version string) (string, error) {
+	header := map[string]string{"If-None-Match": "*"}
+	if version != "" {
+		header = map[string]string{"If-Match": `"` + version + `"`}
+	}
+
+	var etag string
+	err := b.upload(ctx, filename, data,
+		request.WithSetRequestHeaders(header),
+		request.WithGetResponseHeader("ETag", &etag),
+	)
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(etag, `"`), nil
+}
+
+func (b *S3) upload(ctx context.Context, filename string, data io.Reader, opts ...request.Option) error {
+	input := &s3manager.UploadInput{
 		Bucket: aws.String(b.Opts.Bucket),
 		Key:    aws.String(b.path(filename)),
 		Body:   data,
-	})
+	}
+
+	err := b.encryptUpload(input)
+	if err != nil {
+		return b.checkError(err)
+	}
+	b.describeUpload(ctx, input)
+	if isReleaseFile(filename) {
+		b.retainUpload(input)
+	}
+
+	uploader := s3manager.NewUploaderWithClient(b.client())
+	_, err = uploader.UploadWithContext(ctx, input, s3manager.WithUploaderRequestOptions(opts...))
 	if err != nil {
 		return b.checkError(err)
 	}
 	return nil
 }
 
-// Delete deletes the specified file from the backend
-func (b *S3) Delete(filename string) error {
-	_, err := b.client().DeleteObject(&s3.DeleteObjectInput{
+// Delete deletes the specified file from the backend. Files that can't be
+// deleted because of Object Lock retention are reported with a
+// RetentionError. Object Lock requires versioning, where deleting a retained
+// file would succeed by hiding it behind a delete marker, so the file's
+// retention is checked first.
+func (b *S3) Delete(ctx context.Context, filename string) error {
+	if retained := b.retention(ctx, filename); retained != nil {
+		metrics.S3Error()
+		return retained
+	}
+
+	_, err := b.client().DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(b.Opts.Bucket),
 		Key:    aws.String(b.path(filename)),
 	})
@@ -91,52 +331,197 @@ func (b *S3) Delete(filename string) error {
 	return nil
 }
 
+// retention returns a RetentionError if the file is protected by an active
+// Object Lock retention period or legal hold, or nil if it isn't, doesn't
+// exist or its retention can't be read. S3 only returns the retention to
+// callers with the s3:GetObjectRetention and s3:GetObjectLegalHold
+// permissions.
+func (b *S3) retention(ctx context.Context, filename string) error {
+	head, err := b.client().HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.Opts.Bucket),
+		Key:    aws.String(b.path(filename)),
+	})
+	if err != nil {
+		return nil
+	}
+
+	until := aws.TimeValue(head.ObjectLockRetainUntilDate)
+	if until.After(time.Now()) {
+		return &RetentionError{
+			Filename:    filename,
+			Mode:        aws.StringValue(head.ObjectLockMode),
+			RetainUntil: until,
+		}
+	}
+	if aws.StringValue(head.ObjectLockLegalHoldStatus) == s3.ObjectLockLegalHoldStatusOn {
+		return &RetentionError{Filename: filename}
+	}
+	return nil
+}
+
 // List lists all files in the specified path on the backend
-func (b *S3) List() (ret []string, err error) {
+func (b *S3) List(ctx context.Context) ([]string, error) {
+	objects, err := b.ListDetailed(ctx)
+	return names(objects), err
+}
+
+// ListDetailed lists all files in the specified path on the backend along
+// with their metadata
+func (b *S3) ListDetailed(ctx context.Context) (ret []*ObjectInfo, err error) {
 	path := b.path("")
-	result, err := b.client().ListObjects(&s3.ListObjectsInput{
+	pages := 0
+	err = b.client().ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
 		Bucket:    aws.String(b.Opts.Bucket),
 		Delimiter: aws.String(delimiter),
 		Prefix:    aws.String(path),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		pages++
+		for _, obj := range page.Contents {
+			ret = append(ret, &ObjectInfo{
+				// trim the leading path from the filename
+				Name:    strings.Replace(*obj.Key, path, "", 1),
+				Size:    aws.Int64Value(obj.Size),
+				ModTime: aws.TimeValue(obj.LastModified),
+				ETag:    strings.Trim(aws.StringValue(obj.ETag), `"`),
+			})
+		}
+		return true
 	})
 	if err != nil {
 		return nil, b.checkError(err)
 	}
 
-	for _, obj := range result.Contents {
-		// trim the leading path from the filename
-		ret = append(ret, strings.Replace(*obj.Key, path, "", 1))
+	// each additional page means the first response was truncated
+	if pages > 1 {
+		metrics.S3TruncatedList(pages - 1)
 	}
-	return ret, err
+	return ret, nil
 }
 
-func (b *S3) path(filename string) string {
-	path := b.BackendConfig.StoragePath
-	// remove leading /
-	if path[0:1] == delimiter {
-		path = path[1:]
+// describeUpload attaches the context's metadata to the upload as user
+// metadata and, if enabled, as object tags
+func (b *S3) describeUpload(ctx context.Context, input *s3manager.UploadInput) {
+	metadata := MetadataFromContext(ctx)
+	if len(metadata) == 0 {
+		return
 	}
 
-	// remove trailing /
-	if len(path) > 0 && path[len(path)-1:] == delimiter {
-		path = path[:len(path)-1]
+	input.Metadata = map[string]*string{}
+	tags := url.Values{}
+	for k, v := range metadata {
+		v = s3TagValue(v)
+		input.Metadata[k] = aws.String(v)
+		tags.Set(k, v)
+	}
+	if b.Opts.Tagging {
+		input.Tagging = aws.String(tags.Encode())
 	}
-	return path + "/" + filename
+}
+
+// retainUpload sets the configured storage class and Object Lock retention.
+// They're only applied to releases since the state and lock files are
+// rewritten continuously.
+func (b *S3) retainUpload(input *s3manager.UploadInput) {
+	if b.Opts.StorageClass != "" {
+		input.StorageClass = aws.String(b.Opts.StorageClass)
+	}
+	if b.Opts.Retention != nil && b.Opts.Retention.Mode != "" {
+		input.ObjectLockMode = aws.String(b.Opts.Retention.Mode)
+		input.ObjectLockRetainUntilDate = aws.Time(time.Now().Add(b.Opts.Retention.Period))
+	}
+}
+
+// s3TagValue replaces the characters that aren't allowed in tag values and
+// truncates the value to the maximum tag value length. The result is also a
+// valid metadata header value.
+func s3TagValue(v string) string {
+	v = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune(" +-=._:/@", r):
+			return r
+		default:
+			return '_'
+		}
+	}, v)
+	if len(v) > s3MaxTagValueLen {
+		v = v[:s3MaxTagValueLen]
+	}
+	return v
+}
+
+// encryptUpload sets the configured server-side encryption options on the upload
+func (b *S3) encryptUpload(input *s3manager.UploadInput) error {
+	enc := b.Opts.Encryption
+	if enc.CustomerKey != "" {
+		key, err := base64.StdEncoding.DecodeString(enc.CustomerKey)
+		if err != nil {
+			return err
+		}
+		input.SSECustomerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+		input.SSECustomerKey = aws.String(string(key))
+		return nil
+	}
+
+	if enc.ServerSideEncryption == "" {
+		return nil
+	}
+	input.ServerSideEncryption = aws.String(enc.ServerSideEncryption)
+
+	if enc.KMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(enc.KMSKeyID)
+	}
+
+	// the encryption context header is base64 encoded JSON
+	if len(enc.KMSEncryptionContext) > 0 {
+		ctx, err := json.Marshal(enc.KMSEncryptionContext)
+		if err != nil {
+			return err
+		}
+		input.SSEKMSEncryptionContext = aws.String(base64.StdEncoding.EncodeToString(ctx))
+	}
+	return nil
+}
+
+func (b *S3) path(filename string) string {
+	return objectPath(b.BackendConfig.StoragePath, filename)
 }
 
 func (b *S3) client() *s3.S3 {
-	if b.svc == nil || b.svc.Config.Credentials.IsExpired() {
-		sess := session.Must(session.NewSession(&aws.Config{
+	return b.svc
+}
+
+// newClient returns a client whose credentials are cached and refreshed
+// before they expire, so long-running exports never use expired credentials
+func (b *S3) newClient() (*s3.S3, error) {
+	opts := session.Options{
+		Config: aws.Config{
 			Region:      aws.String(b.Opts.Region),
 			Credentials: b.getCreds(),
-		}))
+		},
+		Profile: b.Opts.Auth.Profile,
+	}
+	if b.Opts.Auth.Profile != "" {
+		opts.SharedConfigState = session.SharedConfigEnable
+	}
+	sess, err := session.NewSessionWithOptions(opts)
+	if err != nil {
+		return nil, err
+	}
 
-		svc := s3.New(sess, &aws.Config{
-			Region: aws.String(b.Opts.Region),
-		})
-		b.svc = svc
+	cfg := &aws.Config{
+		Credentials:      b.roleCreds(sess),
+		Region:           aws.String(b.Opts.Region),
+		S3ForcePathStyle: aws.Bool(b.Opts.Endpoint.ForcePathStyle),
 	}
-	return b.svc
+	if b.Opts.Endpoint.URL != "" {
+		cfg.Endpoint = aws.String(b.Opts.Endpoint.URL)
+	}
+	if b.httpClient != nil {
+		cfg.HTTPClient = b.httpClient
+	}
+	return s3.New(sess, cfg), nil
 }
 
 func (b *S3) getCreds() *credentials.Credentials {
@@ -157,19 +542,66 @@ func (b *S3) getCreds() *credentials.Credentials {
 	})
 }
 
+// roleCreds returns the credentials of the configured role, assumed with the
+// web identity token if one is configured and with the session's credentials
+// otherwise, or nil to use the session's credentials directly
+func (b *S3) roleCreds(sess *session.Session) *credentials.Credentials {
+	auth := b.Opts.Auth
+	if auth.RoleARN == "" {
+		return nil
+	}
+
+	sessionName := auth.RoleSessionName
+	if sessionName == "" {
+		sessionName = s3DefaultRoleSessionName
+	}
+
+	if auth.WebIdentityTokenFile != "" {
+		p := stscreds.NewWebIdentityRoleProvider(sts.New(sess), auth.RoleARN, sessionName, auth.WebIdentityTokenFile)
+		p.ExpiryWindow = s3CredentialsExpiryWindow
+		return credentials.NewCredentials(p)
+	}
+	return stscreds.NewCredentials(sess, auth.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+		if auth.ExternalID != "" {
+			p.ExternalID = aws.String(auth.ExternalID)
+		}
+		p.RoleSessionName = sessionName
+		p.ExpiryWindow = s3CredentialsExpiryWindow
+	})
+}
+
 func (b *S3) checkError(err error) error {
 	metrics.S3Error()
-	b.svc.Config.Credentials.Expire()
 	// Print the error, cast err to awserr.Error to get the Code and
 	// Message from an error.
 	if aerr, ok := err.(awserr.Error); ok {
 		switch aerr.Code() {
 		case s3.ErrCodeNoSuchBucket:
 			return fmt.Errorf("%s %s", s3.ErrCodeNoSuchBucket, aerr.Error())
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			return fmt.Errorf("%w: %s", ErrConflict, aerr.Error())
 		default:
-			return fmt.Errorf(aerr.Error())
+			return aerr
 		}
 	} else {
-		return fmt.Errorf(err.Error())
+		return err
+	}
+}
+
+// caBundlePool returns the system cert pool extended with the PEM encoded
+// certificates in the specified file
+func caBundlePool(filename string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("No certificates found in CA bundle %s", filename)
 	}
+	return pool, nil
 }
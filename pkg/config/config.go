@@ -9,6 +9,7 @@ type Config struct {
 	Export        *ExportConfig
 	ClusterConfig *ClusterConfig
 	Import        *ImportConfig
+	Migrate       *MigrateConfig
 	OptionsConfig OptionsConfig
 	DebugMode     bool
 	DryRun        bool
@@ -17,7 +18,59 @@ type Config struct {
 
 //BackendConfig represents configuration options for the backend storage
 type BackendConfig struct {
+	Cache       *CacheConfig
+	Compression string
+	Encryption  *EncryptionConfig
+	Mirror      *MirrorConfig
+	Retry       *RetryConfig
 	StoragePath string
+	Timeout     time.Duration
+	// URL is the backend URL, e.g. s3://bucket/path, if the backend isn't
+	// configured by a backend subcommand
+	URL string
+}
+
+// MirrorConfig represents configuration options for mirroring stored files to local paths
+type MirrorConfig struct {
+	Consistency string
+	Paths       []string
+}
+
+// MigrateConfig represents configuration options for migrating stored state
+type MigrateConfig struct {
+	DeleteSource bool
+	Destination  string
+	Resume       bool
+}
+
+// RetryConfig represents configuration options for retrying failed backend operations
+type RetryConfig struct {
+	InitialBackoff time.Duration
+	MaxAttempts    int
+	MaxBackoff     time.Duration
+}
+
+// CacheConfig represents configuration options for the local cache of stored files
+type CacheConfig struct {
+	Dir string
+	// MaxSize is the maximum total size, in bytes, of the cached files
+	MaxSize int64
+}
+
+// EncryptionConfig represents configuration options for client-side encryption of stored files
+type EncryptionConfig struct {
+	AgeIdentityFile string
+	AgeRecipients   []string
+	// AllowUnencrypted accepts stored files that aren't encrypted, e.g. files
+	// written before encryption was enabled, instead of failing the read
+	AllowUnencrypted   bool
+	DecryptionKeyFiles []string
+	KeyFile            string
+}
+
+// Enabled returns true if any encryption or decryption keys are configured
+func (c *EncryptionConfig) Enabled() bool {
+	return c.KeyFile != "" || len(c.DecryptionKeyFiles) > 0 || len(c.AgeRecipients) > 0 || c.AgeIdentityFile != ""
 }
 
 //ClusterConfig represents kubernetes configuration options
@@ -28,14 +81,29 @@ type ClusterConfig struct {
 
 // ExportConfig represents configurations for manager mode
 type ExportConfig struct {
-	DaemonMode      bool
+	// ClusterName identifies the cluster in the stored files' metadata
+	ClusterName string
+	DaemonMode  bool
+	// LeaseDuration is how long the backend path's lock is held without
+	// being renewed
+	LeaseDuration   time.Duration
 	ReleaseName     string
 	PollingInterval int64
 	Namespaces      []string
+	Reencrypt       bool
+	// SigningKeyFile is the ed25519 private key that signs the manifest
+	SigningKeyFile string
+	StealLock      bool
+	Timeout        time.Duration
 }
 
 //ImportConfig represents configuration options for the backend storage
 type ImportConfig struct {
+	// AllowUnsigned imports releases without a manifest signature by a
+	// trusted key
+	AllowUnsigned bool
+	// AllowUnverified imports releases that don't match the manifest
+	AllowUnverified   bool
 	Force             bool
 	NewStoragePath    string
 	Namespace         string
@@ -43,6 +111,8 @@ type ImportConfig struct {
 	Values            map[string]string
 	ExcludeNamespaces []string
 	Threads           int64
+	// TrustedKeyFiles contain the ed25519 public keys that verify the manifest
+	TrustedKeyFiles []string
 }
 
 // OptionsConfig represents the client configurations options for listing and installing releases
@@ -15,8 +15,16 @@ const (
 const (
 	//ManagerStateFilename is the filename used to store the manager state in the backend
 	ManagerStateFilename = "rlsmgrstate.json"
+	// ManagerLockFilename is the filename used to store the exporter's lease lock in the backend
+	ManagerLockFilename = "rlsmgrlock.json"
+	// ManagerManifestFilename is the filename used to store the digests of the stored releases in the backend
+	ManagerManifestFilename = "rlsmgrmanifest.json"
+	// ManagerSignatureFilename is the filename used to store the signature of the manifest in the backend
+	ManagerSignatureFilename = "rlsmgrmanifest.json.sig"
 	// ReleaseExtension is the file extension to use when storing releases in the backend
 	ReleaseExtension = "release"
+	// EncryptedFileMagic is the prefix identifying files encrypted by the backend
+	EncryptedFileMagic = "RLSMGRENC1"
 )
 
 const (
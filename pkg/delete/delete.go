@@ -1,9 +1,14 @@
 package delete
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
 	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+	"github.com/logicmonitor/k8s-release-manager/pkg/metrics"
 	"github.com/logicmonitor/k8s-release-manager/pkg/release"
 	"github.com/logicmonitor/k8s-release-manager/pkg/state"
 	log "github.com/sirupsen/logrus"
@@ -24,25 +29,32 @@ func New(rlsmgrconfig *config.Config, state *state.State) (*Delete, error) {
 }
 
 // Run the Delete.
-func (d *Delete) Run() error {
-	releaseNames, err := d.State.Releases.StoredReleaseNames()
+func (d *Delete) Run(ctx context.Context) error {
+	releaseNames, err := d.State.Releases.StoredReleaseNames(ctx)
 	if err != nil {
 		log.Fatalf("Error retrieving stored releases: %v", err)
 	}
 
-	err = d.deleteReleases(releaseNames)
+	retained, err := d.deleteReleases(ctx, releaseNames)
 	if err != nil {
 		log.Warnf("%v", err)
 	}
-	return d.deleteState()
+
+	err = d.deleteManifest(ctx, retained)
+	if err != nil {
+		log.Errorf("Error removing manifest: %v", err)
+	}
+	return d.deleteState(ctx)
 }
 
-func (d *Delete) deleteReleases(releaseNames []string) error {
+// deleteReleases removes the stored releases and returns the files that are
+// protected by a retention policy
+func (d *Delete) deleteReleases(ctx context.Context, releaseNames []string) (retained []string, err error) {
 	for _, f := range releaseNames {
 		fmt.Printf("Removing release: %s\n", f)
 		switch true {
 		case d.Config.DryRun:
-			r, e := d.State.Releases.ReadRelease(f)
+			r, e := d.State.Releases.ReadRelease(ctx, f)
 			if e != nil {
 				log.Errorf("Error retrieving remote release %s: %v", f, e)
 			}
@@ -52,16 +64,48 @@ func (d *Delete) deleteReleases(releaseNames []string) error {
 			}
 			continue
 		default:
-			e := d.State.Releases.DeleteRelease(f)
+			e := d.State.Releases.DeleteRelease(ctx, f)
+			if errors.Is(e, backend.ErrRetained) {
+				metrics.RetainedFile()
+				fmt.Printf("Unable to remove release: %v\n", e)
+				retained = append(retained, f)
+				continue
+			}
 			if e != nil {
 				log.Errorf("Error removing remote release %s: %v", f, e)
 				continue
 			}
 		}
 	}
-	return nil
+
+	if len(retained) > 0 {
+		return retained, fmt.Errorf("%d releases are protected by the backend's retention policy and were not removed: %s", len(retained), strings.Join(retained, ", "))
+	}
+	return nil, nil
+}
+
+// deleteManifest removes the manifest, or if some releases couldn't be
+// removed, keeps their entries so they can still be verified on import
+func (d *Delete) deleteManifest(ctx context.Context, retained []string) error {
+	if len(retained) == 0 {
+		return d.State.Releases.RemoveManifest(ctx)
+	}
+
+	manifest, err := d.State.Releases.ReadManifest(ctx)
+	if err != nil || manifest == nil {
+		return err
+	}
+
+	files := map[string]string{}
+	for _, f := range retained {
+		if sum, ok := manifest.Files[f]; ok {
+			files[f] = sum
+		}
+	}
+	manifest.Files = files
+	return d.State.Releases.WriteManifest(ctx, manifest)
 }
 
-func (d *Delete) deleteState() error {
-	return d.State.Remove()
+func (d *Delete) deleteState(ctx context.Context) error {
+	return d.State.Remove(ctx)
 }
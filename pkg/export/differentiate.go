@@ -1,14 +1,17 @@
 package export
 
 import (
+	"context"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
 	"github.com/logicmonitor/k8s-release-manager/pkg/release"
 	log "github.com/sirupsen/logrus"
 	rls "helm.sh/helm/v3/pkg/release"
 )
 
-func (m *Export) currentReleases() ([]*rls.Release, error) {
+func (m *Export) currentReleases(ctx context.Context) ([]*rls.Release, error) {
 	log.Debugf("Finding installed releases.")
-	releases, err := m.HelmClient.ListInstalledReleases()
+	releases, err := m.HelmClient.ListInstalledReleases(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -38,24 +41,29 @@ func (m *Export) filterReleasesByNamespace(releases []*rls.Release) []*rls.Relea
 	return results
 }
 
-func (m *Export) storedReleases() ([]string, error) {
-	names, err := m.State.Releases.StoredReleaseNames()
+func (m *Export) storedReleases(ctx context.Context) ([]*backend.ObjectInfo, error) {
+	objects, err := m.State.Releases.StoredReleaseInfo(ctx)
 	if m.Config.DebugMode && err == nil {
-		for _, r := range names {
-			log.Debugf("Found stored release %s", r)
+		for _, o := range objects {
+			log.Debugf("Found stored release %s (%d bytes, modified %s)", o.Name, o.Size, o.ModTime)
 		}
 	}
-	return names, err
+	return objects, err
 }
 
-// updated returns the list of current releases that have yet to be stored
-func updatedReleases(current []*rls.Release, stored []string) (ret []*rls.Release) {
+// updated returns the list of current releases that have yet to be stored.
+// Empty stored files, e.g. left behind by an interrupted upload, are
+// considered missing so that they're replaced.
+func updatedReleases(current []*rls.Release, stored []*backend.ObjectInfo) (ret []*rls.Release) {
 	log.Debugf("Generating list of updated releases.")
 	for _, c := range current {
 		exists := false
 		for _, s := range stored {
-			if s == release.Filename(c) {
-				exists = true
+			if s.Name == release.Filename(c) {
+				exists = s.Size > 0
+				if !exists {
+					log.Warnf("Stored release %s is empty", s.Name)
+				}
 				break
 			}
 		}
@@ -68,19 +76,19 @@ func updatedReleases(current []*rls.Release, stored []string) (ret []*rls.Releas
 }
 
 // deleted returns the filenames of stored releases that not longer exist
-func deletedReleases(current []*rls.Release, stored []string) (ret []string) {
+func deletedReleases(current []*rls.Release, stored []*backend.ObjectInfo) (ret []string) {
 	log.Debugf("Generating list of deleted releases.")
 	for _, s := range stored {
 		exists := false
 		for _, c := range current {
-			if s == release.Filename(c) {
+			if s.Name == release.Filename(c) {
 				exists = true
 				break
 			}
 		}
 		if !exists {
-			ret = append(ret, s)
-			log.Debugf("Found release to delete %s", s)
+			ret = append(ret, s.Name)
+			log.Debugf("Found release to delete %s", s.Name)
 		}
 	}
 	return ret
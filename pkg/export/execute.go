@@ -1,17 +1,22 @@
 package export
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
 	"sync"
 
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
 	"github.com/logicmonitor/k8s-release-manager/pkg/metrics"
 	"github.com/logicmonitor/k8s-release-manager/pkg/release"
+	"github.com/logicmonitor/k8s-release-manager/pkg/state"
 	log "github.com/sirupsen/logrus"
 	rls "helm.sh/helm/v3/pkg/release"
 )
 
-func (m *Export) printReleases() error {
-	currentReleases, err := m.currentReleases()
+func (m *Export) printReleases(ctx context.Context) error {
+	currentReleases, err := m.currentReleases(ctx)
 	if err != nil {
 		return err
 	}
@@ -21,70 +26,177 @@ func (m *Export) printReleases() error {
 	return nil
 }
 
-func (m *Export) exportReleases() error {
-	currentReleases, err := m.currentReleases()
+func (m *Export) exportReleases(ctx context.Context) error {
+	currentReleases, err := m.currentReleases(ctx)
 	if err != nil {
 		metrics.HelmError()
 		metrics.JobError()
 		return err
 	}
 
-	storedReleaseNames, err := m.storedReleases()
+	storedReleases, err := m.storedReleases(ctx)
 	if err != nil {
 		metrics.StateError()
 		metrics.JobError()
 		return err
 	}
 
-	err = m.State.Update(currentReleases)
+	err = m.State.Update(ctx, currentReleases)
 	if err != nil {
 		metrics.StateError()
 		log.Warnf("%v", err)
 	}
-	return m.export(currentReleases, storedReleaseNames)
+	return m.export(ctx, currentReleases, storedReleases)
 }
 
-func (m *Export) export(current []*rls.Release, stored []string) error {
+func (m *Export) export(ctx context.Context, current []*rls.Release, stored []*backend.ObjectInfo) error {
 	var wg sync.WaitGroup
+	var written map[string]string
 
 	wg.Add(2)
-	go func(current []*rls.Release, stored []string) {
+	go func(current []*rls.Release, stored []*backend.ObjectInfo) {
 		defer wg.Done()
-		m.updateReleases(current, stored)
+		written = m.updateReleases(ctx, current, stored)
 	}(current, stored)
 
-	go func(current []*rls.Release, stored []string) {
+	go func(current []*rls.Release, stored []*backend.ObjectInfo) {
 		defer wg.Done()
-		m.deleteReleases(current, stored)
+		m.deleteReleases(ctx, current, stored)
 	}(current, stored)
 
 	wg.Wait()
-	return nil
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	err := m.updateManifest(ctx, current, written)
+	if err != nil {
+		metrics.StateError()
+		log.Warnf("Error updating manifest: %v", err)
+	}
+	return ctx.Err()
+}
+
+// updateReleases writes the new and updated releases and returns the digests
+// of the files that were written
+func (m *Export) updateReleases(ctx context.Context, current []*rls.Release, stored []*backend.ObjectInfo) map[string]string {
+	return m.writeReleases(ctx, updatedReleases(current, stored))
 }
 
-func (m *Export) updateReleases(current []*rls.Release, stored []string) {
+// writeReleases writes the releases and returns the digests of the files that
+// were written
+func (m *Export) writeReleases(ctx context.Context, releases []*rls.Release) map[string]string {
+	var mu sync.Mutex
 	var wg sync.WaitGroup
+	written := map[string]string{}
 
-	updatedReleases := updatedReleases(current, stored)
-	for _, r := range updatedReleases {
+	for _, r := range releases {
 		metrics.JobCount()
 		wg.Add(1)
 		go func(r *rls.Release) {
 			defer wg.Done()
-			err := m.State.Releases.WriteRelease(r)
+			sum, err := m.State.Releases.WriteRelease(ctx, r)
 			if err != nil {
 				metrics.SaveError()
 				metrics.JobError()
 				log.Warnf("%v", err)
 			} else {
 				metrics.SaveCount()
+				mu.Lock()
+				written[release.Filename(r)] = sum
+				mu.Unlock()
 			}
 		}(r)
 	}
 	wg.Wait()
+	return written
+}
+
+// updateManifest records the digest of every stored release file. Files that
+// weren't written by this export keep their previous digest. If there's no
+// manifest yet, e.g. the first time export runs against an existing storage
+// path, the stored files are hashed to create it. Otherwise files the
+// manifest doesn't list, which export didn't write, are reported and left out
+// so import refuses them.
+//
+// A signed manifest only lists digests export calculated itself, so stored
+// files are never hashed. Digests are only carried over from a manifest with
+// a valid signature by the signing key, and current releases without one are
+// written again.
+func (m *Export) updateManifest(ctx context.Context, current []*rls.Release, written map[string]string) error {
+	if m.Config.DryRun {
+		return nil
+	}
+
+	old, err := m.State.Releases.ReadManifest(ctx)
+	if err != nil {
+		return err
+	}
+	signed, err := m.State.Releases.SignatureCurrent(ctx, old)
+	if err != nil {
+		return err
+	}
+
+	signing := m.State.Releases.SigningKey != nil
+	bootstrap := old == nil && !signing
+	if old == nil || (signing && !signed) {
+		old = &state.Manifest{}
+	}
+
+	if signing {
+		var unsigned []*rls.Release
+		for _, r := range current {
+			f := release.Filename(r)
+			if _, ok := written[f]; ok {
+				continue
+			}
+			if _, ok := old.Files[f]; !ok {
+				log.Infof("Writing release %s again to sign its digest", f)
+				unsigned = append(unsigned, r)
+			}
+		}
+		for f, sum := range m.writeReleases(ctx, unsigned) {
+			written[f] = sum
+		}
+	}
+
+	filenames, err := m.State.Releases.StoredReleaseNames(ctx)
+	if err != nil {
+		return err
+	}
+
+	manifest := &state.Manifest{Files: map[string]string{}}
+	for _, f := range filenames {
+		if sum, ok := written[f]; ok {
+			manifest.Files[f] = sum
+			continue
+		}
+		if sum, ok := old.Files[f]; ok {
+			manifest.Files[f] = sum
+			continue
+		}
+		if !bootstrap {
+			metrics.StateError()
+			log.Warnf("Stored release %s isn't listed in the manifest and wasn't written by export. Leaving it out of the manifest.", f)
+			continue
+		}
+
+		log.Infof("Adding stored release %s to the new manifest", f)
+		sr, err := m.State.Releases.ReadReleaseFile(ctx, f)
+		if err != nil {
+			log.Warnf("Unable to add %s to the manifest: %v", f, err)
+			continue
+		}
+		manifest.Files[f] = sr.SHA256
+	}
+
+	if signed && reflect.DeepEqual(manifest.Files, old.Files) {
+		return nil
+	}
+	return m.State.Releases.WriteManifest(ctx, manifest)
 }
 
-func (m *Export) deleteReleases(current []*rls.Release, stored []string) {
+func (m *Export) deleteReleases(ctx context.Context, current []*rls.Release, stored []*backend.ObjectInfo) {
 	var wg sync.WaitGroup
 
 	deletedReleases := deletedReleases(current, stored)
@@ -93,8 +205,11 @@ func (m *Export) deleteReleases(current []*rls.Release, stored []string) {
 		wg.Add(1)
 		go func(f string) {
 			defer wg.Done()
-			err := m.State.Releases.DeleteRelease(f)
-			if err != nil {
+			err := m.State.Releases.DeleteRelease(ctx, f)
+			if errors.Is(err, backend.ErrRetained) {
+				metrics.RetainedFile()
+				log.Warnf("Keeping deleted release: %v", err)
+			} else if err != nil {
 				metrics.DeleteError()
 				metrics.JobError()
 				log.Warnf("%v", err)
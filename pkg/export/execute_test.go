@@ -0,0 +1,134 @@
+package export
+
+import (
+	"context"
+	"crypto/ed25519"
+	"strings"
+	"testing"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+	"github.com/logicmonitor/k8s-release-manager/pkg/release"
+	"github.com/logicmonitor/k8s-release-manager/pkg/state"
+	rls "helm.sh/helm/v3/pkg/release"
+)
+
+func newTestExport(t *testing.T) *Export {
+	t.Helper()
+	cfg := &config.Config{
+		Backend: &config.BackendConfig{StoragePath: "export"},
+		Export:  &config.ExportConfig{},
+	}
+	s := &state.State{Backend: &backend.Memory{BackendConfig: cfg.Backend}, Config: cfg}
+	err := s.Backend.Init(context.Background())
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	err = s.Init()
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	return &Export{Config: cfg, State: s}
+}
+
+// testExport writes the releases and updates the manifest like an export cycle
+func (m *Export) testExport(t *testing.T, current []*rls.Release) {
+	t.Helper()
+	ctx := context.Background()
+	err := m.updateManifest(ctx, current, m.writeReleases(ctx, current))
+	if err != nil {
+		t.Fatalf("updateManifest: %v", err)
+	}
+}
+
+func (m *Export) plant(t *testing.T, filename string) {
+	t.Helper()
+	err := m.State.Backend.Write(context.Background(), filename, strings.NewReader(`{"name":"planted"}`))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+}
+
+func (m *Export) verify(t *testing.T, trusted []ed25519.PublicKey) []string {
+	t.Helper()
+	ctx := context.Background()
+	manifest, err := m.State.Releases.ReadManifest(ctx)
+	if err != nil || manifest == nil {
+		t.Fatalf("ReadManifest = %v, %v", manifest, err)
+	}
+	files, err := m.State.Releases.StoredReleaseFiles(ctx)
+	if err != nil {
+		t.Fatalf("StoredReleaseFiles: %v", err)
+	}
+	if trusted != nil {
+		sig, err := m.State.Releases.ReadSignature(ctx)
+		if err != nil {
+			t.Fatalf("ReadSignature: %v", err)
+		}
+		err = manifest.VerifySignature(sig, trusted)
+		if err != nil {
+			t.Fatalf("VerifySignature: %v", err)
+		}
+	}
+	return manifest.Verify(files)
+}
+
+func TestUpdateManifestLeavesOutPlantedReleases(t *testing.T) {
+	m := newTestExport(t)
+	a := &rls.Release{Name: "a", Namespace: "default", Version: 1}
+
+	// stored before the manifest existed
+	m.plant(t, "old.release")
+	m.testExport(t, []*rls.Release{a})
+	if problems := m.verify(t, nil); len(problems) != 0 {
+		t.Fatalf("Verify after creating the manifest = %v, want no problems", problems)
+	}
+
+	m.plant(t, "planted.release")
+	m.testExport(t, []*rls.Release{a})
+	problems := m.verify(t, nil)
+	if len(problems) != 1 || !strings.HasPrefix(problems[0], "planted.release ") {
+		t.Fatalf("Verify with a planted release = %v, want planted.release to be unlisted", problems)
+	}
+}
+
+func TestUpdateManifestSignsOnlyWrittenReleases(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newTestExport(t)
+	a := &rls.Release{Name: "a", Namespace: "default", Version: 1}
+	b := &rls.Release{Name: "b", Namespace: "default", Version: 1}
+
+	// an unsigned manifest listing a planted copy of b
+	m.testExport(t, []*rls.Release{a})
+	m.plant(t, release.Filename(b))
+	m.plant(t, "planted.release")
+	manifest, err := m.State.Releases.ReadManifest(context.Background())
+	if err != nil {
+		t.Fatalf("ReadManifest: %v", err)
+	}
+	manifest.Files[release.Filename(b)] = "planted"
+	err = m.State.Releases.WriteManifest(context.Background(), manifest)
+	if err != nil {
+		t.Fatalf("WriteManifest: %v", err)
+	}
+
+	// b isn't written by this cycle, so only signing writes it again
+	m.State.Releases.SigningKey = key
+	ctx := context.Background()
+	err = m.updateManifest(ctx, []*rls.Release{a, b}, map[string]string{})
+	if err != nil {
+		t.Fatalf("updateManifest: %v", err)
+	}
+
+	problems := m.verify(t, []ed25519.PublicKey{pub})
+	if len(problems) != 1 || !strings.HasPrefix(problems[0], "planted.release ") {
+		t.Fatalf("Verify of the signed manifest = %v, want only planted.release to be unlisted", problems)
+	}
+	stored, err := m.State.Releases.ReadRelease(ctx, release.Filename(b))
+	if err != nil || stored.Name != "b" {
+		t.Fatalf("stored release %s = %v, %v, want the exported release", release.Filename(b), stored, err)
+	}
+}
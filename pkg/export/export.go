@@ -1,8 +1,13 @@
 package export
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
 	"time"
 
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
 	"github.com/logicmonitor/k8s-release-manager/pkg/config"
 	"github.com/logicmonitor/k8s-release-manager/pkg/healthz"
 	"github.com/logicmonitor/k8s-release-manager/pkg/lmhelm"
@@ -34,11 +39,29 @@ func New(rlsmgrconfig *config.Config, state *state.State) (*Export, error) {
 	}, nil
 }
 
-// Run the Export.
-func (m *Export) Run() error {
+// Run the Export until it completes or the context is cancelled. The
+// backend's lease lock is held for the duration of the export.
+func (m *Export) Run(ctx context.Context) (err error) {
+	ctx = backend.WithMetadata(ctx, map[string]string{
+		backend.MetadataCluster: m.clusterName(),
+	})
+
+	if !m.Config.DryRun {
+		var release func() error
+		ctx, release, err = m.acquireLease(ctx)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if e := release(); e != nil && err == nil {
+				err = e
+			}
+		}()
+	}
+
 	if m.Config.Export.ReleaseName != "" {
 		log.Infof("Cleaning old state")
-		err := m.State.Remove()
+		err := m.State.Remove(ctx)
 		if err != nil {
 			log.Warnf("Error cleaning up old release manager state: %v", err)
 		}
@@ -46,32 +69,162 @@ func (m *Export) Run() error {
 
 	// if not daemon mode, run once and exit
 	if !m.Config.Export.DaemonMode {
-		return m.strategy()()
+		return m.cycle(ctx)
 	}
-	return m.run()
+	return m.run(ctx)
 }
 
-func (m *Export) strategy() func() error {
+// acquireLease acquires the backend's lease lock and keeps it renewed. The
+// returned context is cancelled if the lease is lost, and the returned func
+// releases the lease and reports why it was lost, if it was.
+func (m *Export) acquireLease(ctx context.Context) (context.Context, func() error, error) {
+	lease := &state.Lease{
+		Backend:  m.State.Backend,
+		Config:   m.Config,
+		Duration: m.Config.Export.LeaseDuration,
+		Holder: &state.LeaseHolder{
+			Owner:   leaseOwner(),
+			Cluster: m.clusterName(),
+		},
+	}
+
+	err := m.waitForLease(ctx, lease)
+	var held *state.LeaseHeldError
+	if errors.As(err, &held) {
+		return nil, nil, fmt.Errorf("%v. Use --steal-lock to take it over", err)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error acquiring lock: %v", err)
+	}
+	log.Infof("Acquired lock as %s", lease.Holder.Owner)
+
+	ctx, cancel := context.WithCancel(ctx)
+	lost := make(chan error, 1)
+	go func() {
+		err := lease.KeepAlive(ctx)
+		if err != nil {
+			log.Errorf("Lost lock: %v", err)
+		}
+		lost <- err
+		cancel()
+	}()
+
+	return ctx, func() error {
+		cancel()
+		if err := <-lost; err != nil {
+			return fmt.Errorf("Stopped export after losing lock: %v", err)
+		}
+		// the parent context may already be cancelled on shutdown
+		return lease.Release(context.Background())
+	}, nil
+}
+
+// waitForLease acquires the lease, retrying while another owner holds it
+// until the expiry first reported for that owner has passed, so that a lease
+// left behind by an exporter that exited is taken over. A holder that is
+// still renewing the lease is reported.
+func (m *Export) waitForLease(ctx context.Context, lease *state.Lease) error {
+	var expires time.Time
+	for {
+		err := lease.Acquire(ctx, m.Config.Export.StealLock)
+		var held *state.LeaseHeldError
+		if !errors.As(err, &held) {
+			return err
+		}
+		if expires.IsZero() {
+			expires = held.Holder.Expires
+			log.Infof("%v. Waiting for it to expire", err)
+		} else if time.Now().After(expires) {
+			return err
+		}
+
+		// retry as often as the holder renews, and once more after expiry
+		wait := time.Until(expires)
+		if wait > lease.Duration/3 {
+			wait = lease.Duration / 3
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v: %v", err, ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+// clusterName returns the configured cluster name, defaulting to the address
+// of the current cluster's API server
+func (m *Export) clusterName() string {
+	if m.Config.Export.ClusterName != "" {
+		return m.Config.Export.ClusterName
+	}
+
+	cluster, err := m.HelmClient.Cluster()
+	if err != nil {
+		log.Warnf("Unable to determine the current cluster: %v", err)
+		return "unknown"
+	}
+	return cluster
+}
+
+// leaseOwner identifies this process, e.g. by pod name when running in-cluster
+func leaseOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}
+
+func (m *Export) strategy() func(context.Context) error {
 	if m.Config.DryRun {
 		return m.printReleases
 	}
 	return m.exportReleases
 }
 
-func (m *Export) run() error {
+// cycle runs the strategy once. If the cycle doesn't complete before the
+// export timeout it is abandoned and reported as a failure.
+func (m *Export) cycle(ctx context.Context) error {
+	var cancel context.CancelFunc
+	if m.Config.Export.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, m.Config.Export.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- m.strategy()(ctx)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("Abandoned export: %v", ctx.Err())
+	}
+}
+
+func (m *Export) run(ctx context.Context) error {
 	// start stats server
 	go m.serveStats()
 
-	// daemon mode. run periodically forever
+	// daemon mode. run periodically until cancelled
 	for {
 		log.Debugf("Checking for installed releases")
-		err := m.strategy()()
+		err := m.cycle(ctx)
 		if err != nil {
 			healthz.IncrementFailure()
 			log.Errorf("%v", err)
 		} else {
 			healthz.ResetFailure()
 		}
-		time.Sleep(time.Duration(m.Config.Export.PollingInterval) * time.Second)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(m.Config.Export.PollingInterval) * time.Second):
+		}
 	}
 }
@@ -0,0 +1,67 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/state"
+)
+
+func (m *Export) testLease(owner string, duration time.Duration) *state.Lease {
+	return &state.Lease{
+		Backend:  m.State.Backend,
+		Config:   m.Config,
+		Duration: duration,
+		Holder:   &state.LeaseHolder{Owner: owner, Cluster: "test"},
+	}
+}
+
+func TestWaitForLeaseExpired(t *testing.T) {
+	ctx := context.Background()
+	m := newTestExport(t)
+	// left behind by an exporter that exited without releasing it
+	err := m.testLease("other", 100*time.Millisecond).Acquire(ctx, false)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	err = m.waitForLease(ctx, m.testLease("self", time.Second))
+	if err != nil {
+		t.Fatalf("waitForLease of an expiring lease: %v", err)
+	}
+}
+
+func TestWaitForLeaseRenewed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := newTestExport(t)
+	other := m.testLease("other", 150*time.Millisecond)
+	err := other.Acquire(ctx, false)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	go other.KeepAlive(ctx) // nolint: errcheck
+
+	err = m.waitForLease(ctx, m.testLease("self", 300*time.Millisecond))
+	var held *state.LeaseHeldError
+	if !errors.As(err, &held) || held.Holder.Owner != "other" {
+		t.Fatalf("waitForLease of a renewed lease = %v, want it held by other", err)
+	}
+}
+
+func TestWaitForLeaseCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	m := newTestExport(t)
+	err := m.testLease("other", time.Minute).Acquire(ctx, false)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	err = m.waitForLease(ctx, m.testLease("self", time.Minute))
+	if err == nil || ctx.Err() == nil {
+		t.Fatalf("waitForLease = %v before the context ended", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/logicmonitor/k8s-release-manager/pkg/healthz"
 	log "github.com/sirupsen/logrus"
@@ -16,11 +17,19 @@ func (m *Export) serveStats() {
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
 
-func (m *Export) releasesFunc(w http.ResponseWriter, req *http.Request) { // nolint: unparam
+func (m *Export) releasesFunc(w http.ResponseWriter, req *http.Request) {
 	var message []byte
 	code := http.StatusOK
 
-	releases, err := m.State.Releases.StoredReleaseNames()
+	// ?detailed=true returns the metadata of each stored release instead of
+	// just the filenames
+	var releases interface{}
+	var err error
+	if detailed, _ := strconv.ParseBool(req.URL.Query().Get("detailed")); detailed {
+		releases, err = m.State.Releases.StoredReleaseInfo(req.Context())
+	} else {
+		releases, err = m.State.Releases.StoredReleaseNames(req.Context())
+	}
 	if err != nil {
 		code = http.StatusInternalServerError
 		message = []byte(fmt.Sprintf("Error retrieving stored releases: %v", err))
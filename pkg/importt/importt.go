@@ -1,9 +1,13 @@
 package importt
 
 import (
+	"context"
+	"crypto/ed25519"
 	"fmt"
+	"strings"
 
 	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+	"github.com/logicmonitor/k8s-release-manager/pkg/constants"
 	"github.com/logicmonitor/k8s-release-manager/pkg/lmhelm"
 	"github.com/logicmonitor/k8s-release-manager/pkg/release"
 	"github.com/logicmonitor/k8s-release-manager/pkg/state"
@@ -16,6 +20,8 @@ type Import struct {
 	Config     *config.Config
 	HelmClient *lmhelm.Client
 	State      *state.State
+	// TrustedKeys verify the manifest signature
+	TrustedKeys []ed25519.PublicKey
 }
 
 // New instantiates and returns a Deleter and an error if any.
@@ -35,18 +41,27 @@ func New(rlsmgrconfig *config.Config, state *state.State) (*Import, error) {
 }
 
 // Run the Import
-func (t *Import) Run() error {
-	releases, err := t.State.Releases.StoredReleases()
+func (t *Import) Run(ctx context.Context) error {
+	files, err := t.State.Releases.StoredReleaseFiles(ctx)
 	if err != nil {
 		return fmt.Errorf("Error retrieving stored releases: %v", err)
 	}
 
+	err = t.verify(ctx, files)
+	if err != nil {
+		return err
+	}
+
+	var releases []*rls.Release
+	for _, f := range files {
+		releases = append(releases, f.Release)
+	}
 	releases, err = processReleases(releases, t.Config.Import)
 	if err != nil {
 		return err
 	}
 
-	err = t.State.Read()
+	err = t.State.Read(ctx)
 	if err != nil {
 		return err
 	}
@@ -55,10 +70,10 @@ func (t *Import) Run() error {
 	if err != nil {
 		return err
 	}
-	return t.deployReleases(releases)
+	return t.deployReleases(ctx, releases)
 }
 
-func (t *Import) deployReleases(releases []*rls.Release) error {
+func (t *Import) deployReleases(ctx context.Context, releases []*rls.Release) error {
 	var err error
 	var sem = make(chan int, t.Config.Import.Threads)
 	for _, r := range releases {
@@ -78,7 +93,7 @@ func (t *Import) deployReleases(releases []*rls.Release) error {
 		sem <- 1
 		go func(r *rls.Release) {
 			defer func() { <-sem }()
-			t.deployRelease(r)
+			t.deployRelease(ctx, r)
 			return
 		}(r)
 	}
@@ -87,11 +102,11 @@ func (t *Import) deployReleases(releases []*rls.Release) error {
 	for i := 0; i < cap(sem); i++ {
 		sem <- 1
 	}
-	return nil
+	return ctx.Err()
 }
 
-func (t *Import) deployRelease(r *rls.Release) {
-	err := t.HelmClient.Install(r)
+func (t *Import) deployRelease(ctx context.Context, r *rls.Release) {
+	err := t.HelmClient.Install(ctx, r)
 	if err != nil {
 		if lmhelm.ErrorReleaseExists(err) {
 			fmt.Printf("Skipping release: %s already exists\n", r.Name)
@@ -154,3 +169,75 @@ func (t *Import) resolveStateConflict() error {
 	}
 	return fmt.Errorf("%s\n%s", msg, warn)
 }
+
+// verify checks the stored release files against the manifest written by
+// export, and the manifest's signature against the trusted keys. Files that
+// don't match, a missing manifest or a missing or untrusted signature fail the
+// import unless --allow-unverified or --allow-unsigned is set.
+func (t *Import) verify(ctx context.Context, files []*state.StoredRelease) error {
+	manifest, err := t.State.Releases.ReadManifest(ctx)
+	if err != nil {
+		return fmt.Errorf("Error reading manifest: %v", err)
+	}
+
+	err = t.verifyChecksums(manifest, files)
+	if err != nil {
+		return err
+	}
+	return t.verifySignature(ctx, manifest)
+}
+
+func (t *Import) verifyChecksums(manifest *state.Manifest, files []*state.StoredRelease) error {
+	var problems []string
+	if manifest == nil {
+		problems = []string{fmt.Sprintf("No manifest %s found in path %s", constants.ManagerManifestFilename, t.Config.Backend.StoragePath)}
+	} else {
+		problems = manifest.Verify(files)
+	}
+	if len(problems) == 0 {
+		log.Infof("Verified %d stored releases against the manifest", len(files))
+		return nil
+	}
+
+	msg := fmt.Sprintf("Unable to verify the stored releases:\n%s", strings.Join(problems, "\n"))
+	warn := "The stored releases may have been modified or corrupted. If you really wish to continue, use --allow-unverified"
+	return t.refuse(msg, warn, t.Config.Import.AllowUnverified, "--allow-unverified")
+}
+
+func (t *Import) verifySignature(ctx context.Context, manifest *state.Manifest) error {
+	if manifest == nil {
+		return t.refuse("The stored releases aren't signed", "If you really wish to continue, use --allow-unsigned", t.Config.Import.AllowUnsigned, "--allow-unsigned")
+	}
+
+	sig, err := t.State.Releases.ReadSignature(ctx)
+	if err != nil {
+		return fmt.Errorf("Error reading signature: %v", err)
+	}
+	if len(t.TrustedKeys) == 0 && sig != nil {
+		err = fmt.Errorf("The manifest %s is signed by key %s but no trusted keys are configured. Use --trusted-keys", constants.ManagerManifestFilename, sig.KeyID)
+	} else {
+		err = manifest.VerifySignature(sig, t.TrustedKeys)
+	}
+	if err == nil {
+		log.Infof("Verified the manifest signature by key %s", sig.KeyID)
+		return nil
+	}
+
+	warn := "The stored releases may not have been exported by a trusted Release Manager. If you really wish to continue, use --allow-unsigned"
+	return t.refuse(err.Error(), warn, t.Config.Import.AllowUnsigned, "--allow-unsigned")
+}
+
+// refuse fails the import with the message unless the safety check was
+// overridden by the specified flag. Dry runs print the message and continue.
+func (t *Import) refuse(msg string, warn string, allowed bool, flag string) error {
+	if allowed {
+		log.Warnf("%s\n%s specified. Proceeding...", msg, flag)
+		return nil
+	}
+
+	if t.Config.DryRun {
+		fmt.Printf("%s\n%s\n", msg, warn)
+		return nil
+	}
+	return fmt.Errorf("%s\n%s", msg, warn)
+}
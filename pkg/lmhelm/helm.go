@@ -1,6 +1,8 @@
 package lmhelm
 
 import (
+	"context"
+
 	"github.com/logicmonitor/k8s-release-manager/pkg/config"
 	"github.com/logicmonitor/k8s-release-manager/pkg/constants"
 	log "github.com/sirupsen/logrus"
@@ -34,7 +36,7 @@ func (c *Client) getHelmSettings() *cli.EnvSettings {
 }
 
 // ListInstalledReleases lists all currently installed helm releases
-func (c *Client) ListInstalledReleases() ([]*rls.Release, error) {
+func (c *Client) ListInstalledReleases(ctx context.Context) ([]*rls.Release, error) {
 
 	if err := c.initActionConfig(""); err != nil {
 		return nil, err
@@ -47,7 +49,12 @@ func (c *Client) ListInstalledReleases() ([]*rls.Release, error) {
 	list.Failed = c.optionsConfig.List.Failed
 	list.AllNamespaces = c.optionsConfig.List.AllNamespaces
 
-	results, err := list.Run()
+	// helm's list action doesn't accept a context, so abandon it on cancellation
+	var results []*rls.Release
+	err := runWithContext(ctx, func() (err error) {
+		results, err = list.Run()
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -56,8 +63,8 @@ func (c *Client) ListInstalledReleases() ([]*rls.Release, error) {
 
 }
 
-// Install ...
-func (c *Client) Install(r *rls.Release) error {
+// Install installs the release, aborting if the context is cancelled
+func (c *Client) Install(ctx context.Context, r *rls.Release) error {
 
 	if err := c.initActionConfig(r.Namespace); err != nil {
 		return err
@@ -78,7 +85,7 @@ func (c *Client) Install(r *rls.Release) error {
 
 	log.Debugf("Installing release %s", r.Name)
 
-	rsp, err := install.Run(r.Chart, r.Config)
+	rsp, err := install.RunWithContext(ctx, r.Chart, r.Config)
 
 	if rsp != nil {
 		log.Infof("Release %s status %s", rsp.Name, rsp.Info.Status.String())
@@ -86,6 +93,21 @@ func (c *Client) Install(r *rls.Release) error {
 	return err
 
 }
+
+// Cluster returns the address of the current cluster's API server
+func (c *Client) Cluster() (string, error) {
+	kubeConfig, kubeContext := c.settings.KubeConfig, c.settings.KubeContext
+	if c.clusterConfig.KubeConfig != "" {
+		kubeConfig, kubeContext = c.clusterConfig.KubeConfig, c.clusterConfig.KubeContext
+	}
+
+	restConfig, err := kube.GetConfig(kubeConfig, kubeContext, "").ToRESTConfig()
+	if err != nil {
+		return "", err
+	}
+	return restConfig.Host, nil
+}
+
 func (c *Client) initActionConfig(namespace string) error {
 
 	var err error
@@ -114,3 +136,19 @@ func getActionConfig(kubeConfig, context, namespace string) (*action.Configurati
 
 	return actionConfig, nil
 }
+
+// runWithContext runs f and returns its error, or the context's error if the
+// context is done before f returns
+func runWithContext(ctx context.Context, f func() error) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- f()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -9,6 +9,7 @@ import (
 var (
 	c    *expvar.Map
 	e    *expvar.Map
+	m    *expvar.Map
 	once sync.Once
 )
 
@@ -16,12 +17,25 @@ func init() {
 	once.Do(func() {
 		e = expvar.NewMap("errors")
 		c = expvar.NewMap("jobs")
+		m = expvar.NewMap("mirrorErrors")
+		c.Add("BackendAttempts", 0)
+		c.Add("BackendRetries", 0)
+		c.Add("CacheEvictions", 0)
+		c.Add("CacheHits", 0)
+		c.Add("CacheMisses", 0)
+		c.Add("CompressionBytesSaved", 0)
 		c.Add("DeleteCount", 0)
 		c.Add("FailedJobs", 0)
 		c.Add("TotalJobs", 0)
 		c.Add("SaveCount", 0)
+		c.Add("S3TruncatedLists", 0)
+		c.Add("UnencryptedReads", 0)
+		e.Add("BackendAttemptErrors", 0)
+		e.Add("CacheErrors", 0)
 		e.Add("DeleteErrors", 0)
 		e.Add("HelmErrors", 0)
+		e.Add("RetainedFiles", 0)
+		e.Add("StateConflicts", 0)
 		e.Add("StateErrors", 0)
 		e.Add("SaveErrors", 0)
 	})
@@ -43,11 +57,84 @@ func S3Error() {
 	e.Add("S3Errors", 1)
 }
 
+// S3TruncatedList increments the count of truncated s3 list responses by the
+// number of continuation requests required to complete the listing.
+func S3TruncatedList(n int) {
+	c.Add("S3TruncatedLists", int64(n))
+}
+
+// AzureError increments the azure error count by 1.
+func AzureError() {
+	e.Add("AzureErrors", 1)
+}
+
+// GCSError increments the gcs error count by 1.
+func GCSError() {
+	e.Add("GCSErrors", 1)
+}
+
+// KubernetesError increments the kubernetes error count by 1.
+func KubernetesError() {
+	e.Add("KubernetesErrors", 1)
+}
+
 // LocalError increments the local error count by 1.
 func LocalError() {
 	e.Add("LocalErrors", 1)
 }
 
+// EncryptionError increments the encryption error count by 1.
+func EncryptionError() {
+	e.Add("EncryptionErrors", 1)
+}
+
+// UnencryptedRead increments the count of files read without encryption while
+// encryption is enabled by 1.
+func UnencryptedRead() {
+	c.Add("UnencryptedReads", 1)
+}
+
+// BackendAttempt increments the count of backend operation attempts by 1.
+func BackendAttempt() {
+	c.Add("BackendAttempts", 1)
+}
+
+// BackendRetry increments the count of retried backend operations by 1.
+func BackendRetry() {
+	c.Add("BackendRetries", 1)
+}
+
+// BackendAttemptError increments the count of failed backend operation
+// attempts by 1.
+func BackendAttemptError() {
+	e.Add("BackendAttemptErrors", 1)
+}
+
+// CacheHit increments the count of files read from the local cache by 1.
+func CacheHit() {
+	c.Add("CacheHits", 1)
+}
+
+// CacheMiss increments the count of files that weren't in the local cache by 1.
+func CacheMiss() {
+	c.Add("CacheMisses", 1)
+}
+
+// CacheEviction increments the count of files evicted from the local cache by 1.
+func CacheEviction() {
+	c.Add("CacheEvictions", 1)
+}
+
+// CacheError increments the local cache error count by 1.
+func CacheError() {
+	e.Add("CacheErrors", 1)
+}
+
+// MirrorError increments the error count of the specified mirror target by 1.
+func MirrorError(target string) {
+	m.Add(target, 1)
+}
+
 // SaveError increments the upload error count by 1.
 func SaveError() {
 	e.Add("SaveErrors", 1)
@@ -58,11 +145,23 @@ func DeleteError() {
 	e.Add("DeleteErrors", 1)
 }
 
+// RetainedFile increments the count of deletes refused because of the
+// backend's retention policy by 1.
+func RetainedFile() {
+	e.Add("RetainedFiles", 1)
+}
+
 // StateError increments the state error count by 1.
 func StateError() {
 	e.Add("StateErrors", 1)
 }
 
+// StateConflict increments the count of state updates rejected because of a
+// concurrent writer by 1.
+func StateConflict() {
+	e.Add("StateConflicts", 1)
+}
+
 // HelmError increments the helm error count by 1.
 func HelmError() {
 	e.Add("HelmErrors", 1)
@@ -73,6 +172,11 @@ func SaveCount() {
 	c.Add("SaveCount", 1)
 }
 
+// CompressionSaved increments the number of bytes saved by compression.
+func CompressionSaved(n int) {
+	c.Add("CompressionBytesSaved", int64(n))
+}
+
 // DeleteCount increments the delete count by 1.
 func DeleteCount() {
 	c.Add("DeleteCount", 1)
@@ -0,0 +1,222 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+	"github.com/logicmonitor/k8s-release-manager/pkg/constants"
+	"github.com/logicmonitor/k8s-release-manager/pkg/state"
+	log "github.com/sirupsen/logrus"
+)
+
+// Migrate copies stored release state from one backend to another
+type Migrate struct {
+	Config      *config.Config
+	Source      backend.Backend
+	Destination backend.Backend
+}
+
+// New instantiates and returns a Migrate and an error if any.
+func New(rlsmgrconfig *config.Config, source backend.Backend, destination backend.Backend) (*Migrate, error) {
+	return &Migrate{
+		Config:      rlsmgrconfig,
+		Source:      source,
+		Destination: destination,
+	}, nil
+}
+
+// Run the Migrate. Source files are only deleted once every file has been
+// copied and verified.
+func (m *Migrate) Run(ctx context.Context) error {
+	// migrating a path to itself would delete every file with --delete-source
+	location := backend.Location(m.Source)
+	if location != "" && location == backend.Location(m.Destination) {
+		return fmt.Errorf("The destination is the same as the source: %s", location)
+	}
+
+	files, err := m.files(ctx, m.Source)
+	if err != nil {
+		return fmt.Errorf("Error listing source files: %v", err)
+	}
+
+	existing, err := m.files(ctx, m.Destination)
+	if err != nil {
+		return fmt.Errorf("Error listing destination files: %v", err)
+	}
+	if len(existing) > 0 && !m.Config.Migrate.Resume {
+		return fmt.Errorf("The destination already contains %d files. Use --resume to continue a previous migration", len(existing))
+	}
+
+	failed := 0
+	for _, f := range files {
+		err = m.migrate(ctx, f, contains(existing, f))
+		if err != nil {
+			failed++
+			log.Errorf("Error migrating %s: %v", f, err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("Failed to migrate %d of %d files. Use --resume to retry", failed, len(files))
+	}
+
+	if m.Config.Migrate.DeleteSource {
+		return m.deleteSource(ctx, files)
+	}
+	return nil
+}
+
+// files returns the release, manifest, signature and manager state files
+// stored in the backend. The manifest, its signature and the state file are
+// last so they are only copied once the releases are.
+func (m *Migrate) files(ctx context.Context, b backend.Backend) (ret []string, err error) {
+	ctx, cancel := state.BackendContext(ctx, m.Config)
+	defer cancel()
+
+	names, err := b.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestFile, signatureFile, stateFile := false, false, false
+	for _, n := range names {
+		switch {
+		case n == constants.ManagerManifestFilename:
+			manifestFile = true
+		case n == constants.ManagerSignatureFilename:
+			signatureFile = true
+		case n == constants.ManagerStateFilename:
+			stateFile = true
+		case strings.HasSuffix(n, "."+constants.ReleaseExtension):
+			ret = append(ret, n)
+		}
+	}
+	if manifestFile {
+		ret = append(ret, constants.ManagerManifestFilename)
+	}
+	if signatureFile {
+		ret = append(ret, constants.ManagerSignatureFilename)
+	}
+	if stateFile {
+		ret = append(ret, constants.ManagerStateFilename)
+	}
+	return ret, nil
+}
+
+// migrate copies the file unless an identical copy already exists, and
+// verifies the copy by reading it back
+func (m *Migrate) migrate(ctx context.Context, f string, exists bool) error {
+	data, err := m.read(ctx, m.Source, f)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+
+	if exists {
+		copied, e := m.read(ctx, m.Destination, f)
+		if e == nil && sha256.Sum256(copied) == sum {
+			fmt.Printf("Skipping migrated file: %s\n", f)
+			return nil
+		}
+	}
+
+	fmt.Printf("Migrating file: %s\n", f)
+	if m.Config.DryRun {
+		return nil
+	}
+
+	err = m.write(ctx, f, data)
+	if err != nil {
+		return err
+	}
+
+	copied, err := m.read(ctx, m.Destination, f)
+	if err != nil {
+		return fmt.Errorf("Error verifying copy: %v", err)
+	}
+	if sha256.Sum256(copied) != sum {
+		return fmt.Errorf("The checksum of the copy doesn't match the source")
+	}
+	return nil
+}
+
+// deleteSource removes the source files, each only once its copy is confirmed
+// to still match it, since the destination may have changed since the file
+// was copied
+func (m *Migrate) deleteSource(ctx context.Context, files []string) error {
+	failed := 0
+	for _, f := range files {
+		fmt.Printf("Removing source file: %s\n", f)
+		if m.Config.DryRun {
+			continue
+		}
+
+		err := m.verify(ctx, f)
+		if err == nil {
+			err = m.delete(ctx, f)
+		}
+		if err != nil {
+			failed++
+			log.Errorf("Error removing source file %s: %v", f, err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("Failed to remove %d of %d source files", failed, len(files))
+	}
+	return nil
+}
+
+// verify returns an error unless the destination holds a copy of the file
+// matching the source
+func (m *Migrate) verify(ctx context.Context, f string) error {
+	data, err := m.read(ctx, m.Source, f)
+	if err != nil {
+		return err
+	}
+	copied, err := m.read(ctx, m.Destination, f)
+	if err != nil {
+		return fmt.Errorf("Error verifying copy: %v", err)
+	}
+	if sha256.Sum256(copied) != sha256.Sum256(data) {
+		return fmt.Errorf("The checksum of the copy doesn't match the source")
+	}
+	return nil
+}
+
+func (m *Migrate) read(ctx context.Context, b backend.Backend, f string) ([]byte, error) {
+	ctx, cancel := state.BackendContext(ctx, m.Config)
+	defer cancel()
+
+	r, err := b.Read(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close() // nolint: errcheck
+	return ioutil.ReadAll(r)
+}
+
+func (m *Migrate) write(ctx context.Context, f string, data []byte) error {
+	ctx, cancel := state.BackendContext(ctx, m.Config)
+	defer cancel()
+	return m.Destination.Write(ctx, f, bytes.NewReader(data))
+}
+
+func (m *Migrate) delete(ctx context.Context, f string) error {
+	ctx, cancel := state.BackendContext(ctx, m.Config)
+	defer cancel()
+	return m.Source.Delete(ctx, f)
+}
+
+func contains(files []string, f string) bool {
+	for _, e := range files {
+		if e == f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package migrate
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+)
+
+func newTestMigrate(t *testing.T, store *backend.MemoryStore, source string, destination string) *Migrate {
+	t.Helper()
+	cfg := &config.Config{
+		Backend: &config.BackendConfig{StoragePath: source},
+		Migrate: &config.MigrateConfig{DeleteSource: true},
+	}
+	m := &Migrate{
+		Config:      cfg,
+		Source:      &backend.Memory{BackendConfig: cfg.Backend, Opts: &backend.MemoryOpts{Store: store}},
+		Destination: &backend.Memory{BackendConfig: &config.BackendConfig{StoragePath: destination}, Opts: &backend.MemoryOpts{Store: store}},
+	}
+	err := m.Source.Write(context.Background(), "a.release", strings.NewReader("a"))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return m
+}
+
+func TestMigrateSameLocation(t *testing.T) {
+	m := newTestMigrate(t, backend.NewMemoryStore(), "releases", "/releases/")
+	err := m.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "same as the source") {
+		t.Fatalf("Run = %v, want the same location refused", err)
+	}
+
+	files, err := m.Source.List(context.Background())
+	if err != nil || len(files) != 1 {
+		t.Fatalf("source lists %v, %v, want the release kept", files, err)
+	}
+}
+
+func TestMigrateDeleteSourceVerifiesCopy(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMigrate(t, backend.NewMemoryStore(), "source", "destination")
+	err := m.Run(ctx)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	files, err := m.Source.List(ctx)
+	if err != nil || len(files) != 0 {
+		t.Fatalf("source lists %v, %v after Run, want no files", files, err)
+	}
+
+	// the copy was replaced after it was verified
+	err = m.Source.Write(ctx, "a.release", strings.NewReader("a"))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	err = m.Destination.Write(ctx, "a.release", strings.NewReader("b"))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	err = m.deleteSource(ctx, []string{"a.release"})
+	if err == nil {
+		t.Fatal("deleteSource removed a file whose copy doesn't match")
+	}
+	files, err = m.Source.List(ctx)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("source lists %v, %v, want the release kept", files, err)
+	}
+}
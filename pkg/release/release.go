@@ -1,6 +1,7 @@
 package release
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
@@ -56,11 +57,17 @@ func Filename(r *rls.Release) string {
 	return fmt.Sprintf("%s-%d-%d.%s", r.Name, r.Version, t.Second(), constants.ReleaseExtension)
 }
 
-// FromFile returns a release struct from raw bytes
-func FromFile(f []byte) (r *rls.Release, err error) {
+// FromFile returns a release struct decoded from the file's stream
+func FromFile(f io.Reader) (r *rls.Release, err error) {
+	br := bufio.NewReader(f)
+	magic, err := br.Peek(len(constants.EncryptedFileMagic))
+	if err == nil && string(magic) == constants.EncryptedFileMagic {
+		return nil, fmt.Errorf("The release file is encrypted and no matching decryption key is configured. Use --encryptionKeyFile, --decryptionKeyFiles or --ageIdentityFile")
+	}
+
 	r = &rls.Release{}
 
-	err = json.Unmarshal(f, r)
+	err = json.NewDecoder(br).Decode(r)
 	if err != nil {
 		return nil, err
 	}
@@ -22,7 +22,7 @@ func (i *Info) Serialize() (io.Reader, error) {
 	return bytes.NewReader(b), nil
 }
 
-// Deserialize the state
-func (i *Info) Deserialize(f []byte) error {
-	return json.Unmarshal(f, i)
+// Deserialize the state from the file's stream
+func (i *Info) Deserialize(f io.Reader) error {
+	return json.NewDecoder(f).Decode(i)
 }
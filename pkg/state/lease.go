@@ -0,0 +1,196 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+	"github.com/logicmonitor/k8s-release-manager/pkg/constants"
+	log "github.com/sirupsen/logrus"
+)
+
+// Lease is a time limited lock stored in the backend that prevents multiple
+// exporters from writing to the same path. The holder must renew the lease
+// before it expires or another exporter may acquire it.
+type Lease struct {
+	Backend  backend.Backend
+	Config   *config.Config
+	Duration time.Duration
+	Holder   *LeaseHolder
+}
+
+// LeaseHolder identifies the holder of a lease
+type LeaseHolder struct {
+	Owner   string    `json:"owner"`
+	Cluster string    `json:"cluster"`
+	Expires time.Time `json:"expires"`
+}
+
+// LeaseHeldError is returned when the lease is held by another owner
+type LeaseHeldError struct {
+	Holder *LeaseHolder
+}
+
+func (e *LeaseHeldError) Error() string {
+	return fmt.Sprintf("Lock %s is held by %s in cluster %s until %s", constants.ManagerLockFilename, e.Holder.Owner, e.Holder.Cluster, e.Holder.Expires.Format(time.RFC3339))
+}
+
+// Acquire the lease if it is free, expired, or already held by the owner. If
+// steal is true the lease is acquired even if another owner holds it.
+func (l *Lease) Acquire(ctx context.Context, steal bool) error {
+	current, version, err := l.read(ctx)
+	if err != nil {
+		return err
+	}
+
+	if current != nil && current.Owner != l.Holder.Owner && time.Now().Before(current.Expires) {
+		if !steal {
+			return &LeaseHeldError{Holder: current}
+		}
+		log.Warnf("Stealing lock %s from %s in cluster %s", constants.ManagerLockFilename, current.Owner, current.Cluster)
+	}
+	return l.write(ctx, version)
+}
+
+// Renew extends the lease. It fails if another owner has taken the lease over.
+func (l *Lease) Renew(ctx context.Context) error {
+	current, version, err := l.read(ctx)
+	if err != nil {
+		return err
+	}
+	if current != nil && current.Owner != l.Holder.Owner {
+		return &LeaseHeldError{Holder: current}
+	}
+	return l.write(ctx, version)
+}
+
+// KeepAlive renews the lease periodically until the context is cancelled. It
+// returns an error if the lease is taken over or expires before it can be
+// renewed.
+func (l *Lease) KeepAlive(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(l.Duration / 3):
+		}
+
+		err := l.Renew(ctx)
+		var held *LeaseHeldError
+		switch {
+		case err == nil, ctx.Err() != nil:
+		case errors.As(err, &held):
+			return err
+		case time.Now().After(l.Holder.Expires):
+			return fmt.Errorf("Lock %s expired before it could be renewed: %v", constants.ManagerLockFilename, err)
+		default:
+			log.Warnf("Error renewing lock %s: %v", constants.ManagerLockFilename, err)
+		}
+	}
+}
+
+// Release the lease if it is still held by the owner
+func (l *Lease) Release(ctx context.Context) error {
+	current, _, err := l.read(ctx)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.Owner != l.Holder.Owner || l.Config.DryRun {
+		return nil
+	}
+
+	ctx, cancel := BackendContext(ctx, l.Config)
+	defer cancel()
+
+	log.Debugf("Releasing lock %s", constants.ManagerLockFilename)
+	return l.Backend.Delete(ctx, constants.ManagerLockFilename)
+}
+
+// read returns the current holder and version of the lease, or a nil holder
+// if the lease doesn't exist
+func (l *Lease) read(ctx context.Context) (*LeaseHolder, string, error) {
+	ctx, cancel := BackendContext(ctx, l.Config)
+	defer cancel()
+
+	files, err := l.Backend.List(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	exists := false
+	for _, f := range files {
+		if f == constants.ManagerLockFilename {
+			exists = true
+			break
+		}
+	}
+	if !exists {
+		return nil, "", nil
+	}
+
+	var f io.ReadCloser
+	version := ""
+	cw, ok := l.Backend.(backend.ConditionalWriter)
+	if ok {
+		f, version, err = cw.ReadVersion(ctx, constants.ManagerLockFilename)
+	}
+	if !ok || errors.Is(err, backend.ErrConditionalWriteUnsupported) {
+		f, err = l.Backend.Read(ctx, constants.ManagerLockFilename)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close() // nolint: errcheck
+
+	holder := &LeaseHolder{}
+	err = json.NewDecoder(f).Decode(holder)
+	if err != nil {
+		return nil, "", fmt.Errorf("Error parsing lock %s: %v", constants.ManagerLockFilename, err)
+	}
+	return holder, version, nil
+}
+
+// write stores the lease with a new expiry. If the backend supports
+// conditional writes, the lease is only written if it hasn't been modified
+// since it was read.
+func (l *Lease) write(ctx context.Context, version string) error {
+	holder := *l.Holder
+	holder.Expires = time.Now().Add(l.Duration)
+	b, err := json.Marshal(&holder)
+	if err != nil {
+		return err
+	}
+	if l.Config.DryRun {
+		l.Holder.Expires = holder.Expires
+		return nil
+	}
+
+	wctx, cancel := BackendContext(ctx, l.Config)
+	defer cancel()
+
+	cw, ok := l.Backend.(backend.ConditionalWriter)
+	if ok {
+		_, err = cw.WriteIfMatch(wctx, constants.ManagerLockFilename, bytes.NewReader(b), version)
+	}
+	if !ok || errors.Is(err, backend.ErrConditionalWriteUnsupported) {
+		err = l.Backend.Write(wctx, constants.ManagerLockFilename, bytes.NewReader(b))
+	}
+
+	// another exporter acquired the lease between the read and the write
+	if errors.Is(err, backend.ErrConflict) {
+		current, _, e := l.read(ctx)
+		if e == nil && current != nil {
+			return &LeaseHeldError{Holder: current}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	l.Holder.Expires = holder.Expires
+	return nil
+}
@@ -0,0 +1,150 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/constants"
+	log "github.com/sirupsen/logrus"
+)
+
+// Manifest records the sha256 digest of every release file written by
+// export, so imports can verify that each stored file is the one export wrote.
+// Digests are of the release files' contents before compression or encryption.
+type Manifest struct {
+	// Files maps the release filenames to their hex encoded sha256 digests
+	Files   map[string]string `json:"files"`
+	Updated time.Time         `json:"updated"`
+	// the stored contents, which are what the signature covers
+	raw []byte
+}
+
+// Verify checks the stored releases against the manifest and returns a
+// description of every mismatch, unlisted file and listed file that is no
+// longer stored
+func (m *Manifest) Verify(files []*StoredRelease) (problems []string) {
+	stored := map[string]bool{}
+	for _, f := range files {
+		stored[f.Filename] = true
+		digest, ok := m.Files[f.Filename]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s isn't listed in the manifest", f.Filename))
+		case digest != f.SHA256:
+			problems = append(problems, fmt.Sprintf("%s doesn't match the manifest: expected sha256 %s, found %s", f.Filename, digest, f.SHA256))
+		}
+	}
+
+	for f := range m.Files {
+		if !stored[f] {
+			problems = append(problems, fmt.Sprintf("%s is listed in the manifest but isn't stored", f))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// ReadManifest returns the stored manifest, or nil if there isn't one
+func (rs *ReleaseState) ReadManifest(ctx context.Context) (*Manifest, error) {
+	ctx, cancel := BackendContext(ctx, rs.Config)
+	defer cancel()
+
+	names, err := rs.Backend.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !contains(names, constants.ManagerManifestFilename) {
+		return nil, nil
+	}
+
+	log.Debugf("Reading manifest %s", constants.ManagerManifestFilename)
+	r, err := rs.Backend.Read(ctx, constants.ManagerManifestFilename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close() // nolint: errcheck
+
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{raw: raw}
+	err = json.Unmarshal(raw, m)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding manifest %s: %v", constants.ManagerManifestFilename, err)
+	}
+	if m.Files == nil {
+		m.Files = map[string]string{}
+	}
+	return m, nil
+}
+
+// WriteManifest writes the manifest to the backend, followed by its
+// signature if a signing key is configured
+func (rs *ReleaseState) WriteManifest(ctx context.Context, m *Manifest) error {
+	if rs.Config.DryRun {
+		return nil
+	}
+
+	m.Updated = time.Now().UTC()
+	f, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = rs.writeManifest(ctx, f)
+	if err != nil {
+		return err
+	}
+	m.raw = f
+	return rs.writeSignature(ctx, f)
+}
+
+func (rs *ReleaseState) writeManifest(ctx context.Context, f []byte) error {
+	ctx, cancel := BackendContext(ctx, rs.Config)
+	defer cancel()
+
+	log.Debugf("Writing manifest %s", constants.ManagerManifestFilename)
+	return rs.Backend.Write(ctx, constants.ManagerManifestFilename, bytes.NewReader(f))
+}
+
+// RemoveManifest deletes the manifest and its signature from the backend if
+// they exist
+func (rs *ReleaseState) RemoveManifest(ctx context.Context) error {
+	if rs.Config.DryRun {
+		return nil
+	}
+
+	err := rs.removeSignature(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := BackendContext(ctx, rs.Config)
+	defer cancel()
+
+	names, err := rs.Backend.List(ctx)
+	if err != nil {
+		return err
+	}
+	if !contains(names, constants.ManagerManifestFilename) {
+		return nil
+	}
+
+	log.Debugf("Removing manifest %s", constants.ManagerManifestFilename)
+	return rs.Backend.Delete(ctx, constants.ManagerManifestFilename)
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,15 @@
 package state
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"regexp"
+	"strconv"
 	"sync"
 
 	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
@@ -17,82 +24,188 @@ import (
 type ReleaseState struct {
 	Backend backend.Backend
 	Config  *config.Config
+	// SigningKey signs the manifest when it's written, if set
+	SigningKey ed25519.PrivateKey
+}
+
+// StoredRelease represents a release file read from the backend
+type StoredRelease struct {
+	Filename string
+	Release  *rls.Release
+	// SHA256 is the hex encoded digest of the release file's contents
+	SHA256 string
 }
 
 // ReadRelease returns the remote release represented by the specified filename
-func (rs *ReleaseState) ReadRelease(f string) (*rls.Release, error) {
+func (rs *ReleaseState) ReadRelease(ctx context.Context, f string) (*rls.Release, error) {
+	sr, err := rs.ReadReleaseFile(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	return sr.Release, nil
+}
+
+// ReadReleaseFile returns the remote release represented by the specified
+// filename along with the digest of the file's contents
+func (rs *ReleaseState) ReadReleaseFile(ctx context.Context, f string) (*StoredRelease, error) {
+	ctx, cancel := BackendContext(ctx, rs.Config)
+	defer cancel()
+
 	log.Debugf("Reading remote release %s", f)
-	b, err := rs.Backend.Read(f)
+	r, err := rs.Backend.Read(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close() // nolint: errcheck
+
+	// hash the file as it's decoded rather than buffering it
+	h := sha256.New()
+	tee := io.TeeReader(r, h)
+	rl, err := release.FromFile(tee)
 	if err != nil {
 		return nil, err
 	}
-	return release.FromFile(b)
+	// the decoder may stop before the end of the file
+	_, err = io.Copy(ioutil.Discard, tee)
+	if err != nil {
+		return nil, err
+	}
+	return &StoredRelease{
+		Filename: f,
+		Release:  rl,
+		SHA256:   hex.EncodeToString(h.Sum(nil)),
+	}, nil
 }
 
-// WriteRelease writes the specified release to the backend
-func (rs *ReleaseState) WriteRelease(r *rls.Release) error {
+// WriteRelease writes the specified release to the backend and returns the
+// digest of the written file's contents
+func (rs *ReleaseState) WriteRelease(ctx context.Context, r *rls.Release) (string, error) {
 	f, err := release.ToFile(r)
 	if err != nil {
-		return err
+		return "", err
 	}
 	if rs.Config.DryRun {
-		return nil
+		return "", nil
 	}
+
+	ctx, cancel := BackendContext(ctx, rs.Config)
+	defer cancel()
+
 	log.Debugf("Writing remote release %s", release.Filename(r))
-	return rs.Backend.Write(release.Filename(r), f)
+	h := sha256.New()
+	err = rs.Backend.Write(backend.WithMetadata(ctx, releaseMetadata(r)), release.Filename(r), io.TeeReader(f, h))
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// releaseMetadata describes the release so stored files can be identified
+// without reading them
+func releaseMetadata(r *rls.Release) map[string]string {
+	metadata := map[string]string{
+		backend.MetadataNamespace: r.Namespace,
+		backend.MetadataRelease:   r.Name,
+		backend.MetadataRevision:  strconv.Itoa(r.Version),
+	}
+	if r.Chart != nil && r.Chart.Metadata != nil {
+		metadata[backend.MetadataChart] = r.Chart.Metadata.Name
+		metadata[backend.MetadataChartVersion] = r.Chart.Metadata.Version
+	}
+	return metadata
 }
 
 // DeleteRelease deletes the remote release represented by the specified filename
-func (rs *ReleaseState) DeleteRelease(f string) error {
+func (rs *ReleaseState) DeleteRelease(ctx context.Context, f string) error {
 	if rs.Config.DryRun {
 		return nil
 	}
+
+	ctx, cancel := BackendContext(ctx, rs.Config)
+	defer cancel()
+
 	log.Debugf("Removing remote release %s", f)
-	return rs.Backend.Delete(f)
+	return rs.Backend.Delete(ctx, f)
 }
 
 // StoredReleases returns the list of release structs currently stored in the backend
-func (rs *ReleaseState) StoredReleases() (ret []*rls.Release, err error) {
-	filenames, err := rs.StoredReleaseNames()
+func (rs *ReleaseState) StoredReleases(ctx context.Context) (ret []*rls.Release, err error) {
+	files, err := rs.StoredReleaseFiles(ctx)
+	for _, f := range files {
+		ret = append(ret, f.Release)
+	}
+	return ret, err
+}
+
+// StoredReleaseFiles returns the release files currently stored in the
+// backend. Files that can't be read are logged and skipped.
+func (rs *ReleaseState) StoredReleaseFiles(ctx context.Context) (ret []*StoredRelease, err error) {
+	filenames, err := rs.StoredReleaseNames(ctx)
 	if err != nil {
 		return ret, err
 	}
 
+	var mu sync.Mutex
 	var wg sync.WaitGroup
 	for _, f := range filenames {
 		wg.Add(1)
-		go func(f string, ret *[]*rls.Release) {
+		go func(f string) {
 			defer wg.Done()
-			r, e := rs.ReadRelease(f)
+			sr, e := rs.ReadReleaseFile(ctx, f)
 			if e != nil {
 				log.Warnf("%v", e)
 				return
 			}
-			*ret = append(*ret, r)
-		}(f, &ret)
+			mu.Lock()
+			ret = append(ret, sr)
+			mu.Unlock()
+		}(f)
 	}
 	wg.Wait()
-	return ret, err
+	return ret, ctx.Err()
 }
 
 // StoredReleaseNames returns the list of release filenames currently stored in the backend
-func (rs *ReleaseState) StoredReleaseNames() (ret []string, err error) {
+func (rs *ReleaseState) StoredReleaseNames(ctx context.Context) (ret []string, err error) {
+	ctx, cancel := BackendContext(ctx, rs.Config)
+	defer cancel()
+
 	log.Debugf("Finding releases stored in the backend.")
-	names, err := rs.Backend.List()
+	names, err := rs.Backend.List(ctx)
 	if err != nil {
 		return ret, err
 	}
 
-	// ignore non release files in path, e.g. state, other cruft outside our control
-	r, err := regexp.Compile(fmt.Sprintf("^.+%s$", constants.ReleaseExtension))
+	for _, n := range names {
+		if isReleaseFile(n) {
+			ret = append(ret, n)
+		}
+	}
+	return ret, err
+}
+
+// StoredReleaseInfo returns the metadata of the release files currently stored in the backend
+func (rs *ReleaseState) StoredReleaseInfo(ctx context.Context) (ret []*backend.ObjectInfo, err error) {
+	ctx, cancel := BackendContext(ctx, rs.Config)
+	defer cancel()
+
+	log.Debugf("Finding releases stored in the backend.")
+	objects, err := rs.Backend.ListDetailed(ctx)
 	if err != nil {
-		return nil, err
+		return ret, err
 	}
 
-	for _, n := range names {
-		if r.MatchString(n) {
-			ret = append(ret, n)
+	for _, o := range objects {
+		if isReleaseFile(o.Name) {
+			ret = append(ret, o)
 		}
 	}
 	return ret, err
 }
+
+// ignore non release files in path, e.g. state, other cruft outside our control
+var releaseFileRegexp = regexp.MustCompile(fmt.Sprintf("^.+%s$", regexp.QuoteMeta(constants.ReleaseExtension)))
+
+func isReleaseFile(filename string) bool {
+	return releaseFileRegexp.MatchString(filename)
+}
@@ -0,0 +1,38 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+)
+
+func TestReadReleaseFileDigest(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{Backend: &config.BackendConfig{StoragePath: "releases"}}
+	rs := &ReleaseState{Backend: &backend.Memory{BackendConfig: cfg.Backend}, Config: cfg}
+	err := rs.Backend.Init(ctx)
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	// the decoder stops reading well before the end of the padding
+	data := append([]byte(`{"name":"a"}`), bytes.Repeat([]byte("\n"), 64*1024)...)
+	err = rs.Backend.Write(ctx, "a.release", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	sr, err := rs.ReadReleaseFile(ctx, "a.release")
+	if err != nil {
+		t.Fatalf("ReadReleaseFile: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	if sr.Release.Name != "a" || sr.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("ReadReleaseFile = %s, %s, want a, %x", sr.Release.Name, sr.SHA256, sum)
+	}
+}
@@ -0,0 +1,201 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/constants"
+	log "github.com/sirupsen/logrus"
+)
+
+const signingKeyIDBytes = 8
+
+// ErrUnsigned is returned when the manifest has no signature
+var ErrUnsigned = errors.New("the manifest isn't signed")
+
+// Signature is an ed25519 signature of the stored manifest. Since the
+// manifest lists the digest of every release file, it covers the releases too.
+type Signature struct {
+	// KeyID identifies the public key that verifies the signature
+	KeyID     string `json:"keyId"`
+	Signature []byte `json:"signature"`
+}
+
+// LoadSigningKey reads a PEM encoded PKCS #8 ed25519 private key, e.g. one
+// generated by openssl genpkey -algorithm ed25519
+func LoadSigningKey(filename string) (ed25519.PrivateKey, error) {
+	f, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(f)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s must contain a PEM encoded ed25519 private key", filename)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing private key %s: %v", filename, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s must contain an ed25519 private key", filename)
+	}
+	return priv, nil
+}
+
+// LoadTrustedKeys reads the PEM encoded ed25519 public keys in the specified
+// files. Each file may contain several keys.
+func LoadTrustedKeys(filenames []string) (ret []ed25519.PublicKey, err error) {
+	for _, filename := range filenames {
+		f, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		count := 0
+		for block, rest := pem.Decode(f); block != nil; block, rest = pem.Decode(rest) {
+			if block.Type != "PUBLIC KEY" {
+				continue
+			}
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("Error parsing public key in %s: %v", filename, err)
+			}
+			pub, ok := key.(ed25519.PublicKey)
+			if !ok {
+				return nil, fmt.Errorf("%s must only contain ed25519 public keys", filename)
+			}
+			ret = append(ret, pub)
+			count++
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("%s must contain a PEM encoded ed25519 public key", filename)
+		}
+	}
+	return ret, nil
+}
+
+// KeyID returns the identifier of the public key recorded in signatures
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:signingKeyIDBytes])
+}
+
+// VerifySignature checks that the manifest was signed by one of the trusted
+// keys
+func (m *Manifest) VerifySignature(sig *Signature, trusted []ed25519.PublicKey) error {
+	if sig == nil {
+		return ErrUnsigned
+	}
+	for _, pub := range trusted {
+		if KeyID(pub) != sig.KeyID {
+			continue
+		}
+		if !ed25519.Verify(pub, m.raw, sig.Signature) {
+			return fmt.Errorf("The signature of manifest %s by key %s is invalid", constants.ManagerManifestFilename, sig.KeyID)
+		}
+		return nil
+	}
+	return fmt.Errorf("The manifest %s is signed by key %s, which isn't trusted", constants.ManagerManifestFilename, sig.KeyID)
+}
+
+// ReadSignature returns the stored manifest signature, or nil if there isn't
+// one
+func (rs *ReleaseState) ReadSignature(ctx context.Context) (*Signature, error) {
+	ctx, cancel := BackendContext(ctx, rs.Config)
+	defer cancel()
+
+	names, err := rs.Backend.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !contains(names, constants.ManagerSignatureFilename) {
+		return nil, nil
+	}
+
+	log.Debugf("Reading signature %s", constants.ManagerSignatureFilename)
+	r, err := rs.Backend.Read(ctx, constants.ManagerSignatureFilename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close() // nolint: errcheck
+
+	sig := &Signature{}
+	err = json.NewDecoder(r).Decode(sig)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding signature %s: %v", constants.ManagerSignatureFilename, err)
+	}
+	return sig, nil
+}
+
+// SignatureCurrent returns true if the stored signature is a valid signature
+// of the manifest by the configured signing key, or if there's no signing key
+// and no signature. Entries of a manifest that isn't signed by the signing key
+// mustn't be carried over into a newly signed manifest.
+func (rs *ReleaseState) SignatureCurrent(ctx context.Context, m *Manifest) (bool, error) {
+	sig, err := rs.ReadSignature(ctx)
+	if err != nil {
+		return false, err
+	}
+	if rs.SigningKey == nil {
+		return sig == nil, nil
+	}
+	if m == nil {
+		return false, nil
+	}
+
+	err = m.VerifySignature(sig, []ed25519.PublicKey{rs.SigningKey.Public().(ed25519.PublicKey)})
+	if err != nil {
+		log.Warnf("Not trusting the stored manifest: %v", err)
+		return false, nil
+	}
+	return true, nil
+}
+
+// writeSignature signs the manifest contents with the signing key, or removes
+// the signature of a previous manifest if there's no signing key
+func (rs *ReleaseState) writeSignature(ctx context.Context, manifest []byte) error {
+	if rs.SigningKey == nil {
+		return rs.removeSignature(ctx)
+	}
+
+	f, err := json.Marshal(&Signature{
+		KeyID:     KeyID(rs.SigningKey.Public().(ed25519.PublicKey)),
+		Signature: ed25519.Sign(rs.SigningKey, manifest),
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := BackendContext(ctx, rs.Config)
+	defer cancel()
+
+	log.Debugf("Writing signature %s", constants.ManagerSignatureFilename)
+	return rs.Backend.Write(ctx, constants.ManagerSignatureFilename, bytes.NewReader(f))
+}
+
+func (rs *ReleaseState) removeSignature(ctx context.Context) error {
+	ctx, cancel := BackendContext(ctx, rs.Config)
+	defer cancel()
+
+	names, err := rs.Backend.List(ctx)
+	if err != nil {
+		return err
+	}
+	if !contains(names, constants.ManagerSignatureFilename) {
+		return nil
+	}
+
+	log.Debugf("Removing signature %s", constants.ManagerSignatureFilename)
+	return rs.Backend.Delete(ctx, constants.ManagerSignatureFilename)
+}
@@ -1,12 +1,15 @@
 package state
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
 
 	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
 	"github.com/logicmonitor/k8s-release-manager/pkg/config"
 	"github.com/logicmonitor/k8s-release-manager/pkg/constants"
+	"github.com/logicmonitor/k8s-release-manager/pkg/metrics"
 	"github.com/logicmonitor/k8s-release-manager/pkg/release"
 	log "github.com/sirupsen/logrus"
 	rls "helm.sh/helm/v3/pkg/release"
@@ -19,6 +22,23 @@ type State struct {
 	Info     *Info
 	Releases *ReleaseState
 	init     bool
+	// the version of the state file last written by this manager
+	version string
+}
+
+// ConcurrentWriterError is returned when the state file was modified by
+// another writer, e.g. a second release manager using the same storage path
+type ConcurrentWriterError struct {
+	// the state written by the other writer, if known
+	Info *Info
+}
+
+func (e *ConcurrentWriterError) Error() string {
+	msg := fmt.Sprintf("State file %s was modified by another writer", constants.ManagerStateFilename)
+	if e.Info != nil {
+		msg = fmt.Sprintf("%s for release %s (%s)", msg, e.Info.ReleaseName, e.Info.ReleaseFilename)
+	}
+	return msg + ". Refusing to overwrite it."
 }
 
 // Init the release manager state
@@ -37,7 +57,7 @@ func (s *State) Name() string {
 }
 
 // Update updates the release manager state on the backend
-func (s *State) Update(releases []*rls.Release) error {
+func (s *State) Update(ctx context.Context, releases []*rls.Release) error {
 	if s.Config.Export.ReleaseName == "" {
 		return nil
 	}
@@ -46,7 +66,7 @@ func (s *State) Update(releases []*rls.Release) error {
 	// locate the release managing this application
 	for _, r := range releases {
 		if s.isManagerRelease(r.Name) {
-			return s.updateState(&Info{
+			return s.updateState(ctx, &Info{
 				ReleaseFilename: release.Filename(r),
 				ReleaseName:     s.Config.Export.ReleaseName,
 				ReleaseVersion:  int32(r.Version),
@@ -56,12 +76,13 @@ func (s *State) Update(releases []*rls.Release) error {
 
 	// if the manager release no longer exists, delete the remote state
 	log.Debugf("Release manager release %s doesn't exist. Removing state.", s.Config.Export.ReleaseName)
-	return s.delete()
+	s.init, s.version = false, ""
+	return s.delete(ctx)
 }
 
 // Read the release manager state from the backend
-func (s *State) Read() error {
-	exists, err := s.exists()
+func (s *State) Read(ctx context.Context) error {
+	exists, err := s.exists(ctx)
 	if err != nil {
 		return err
 	}
@@ -69,7 +90,7 @@ func (s *State) Read() error {
 		return nil
 	}
 
-	info, err := s.read()
+	info, err := s.read(ctx)
 	if err != nil {
 		return err
 	}
@@ -78,14 +99,17 @@ func (s *State) Read() error {
 }
 
 // Remove the release manager state from the backend
-func (s *State) Remove() error {
-	return s.delete()
+func (s *State) Remove(ctx context.Context) error {
+	return s.delete(ctx)
 }
 
 // Exists returns true if the remote state file exists
-func (s *State) exists() (bool, error) {
+func (s *State) exists(ctx context.Context) (bool, error) {
+	ctx, cancel := BackendContext(ctx, s.Config)
+	defer cancel()
+
 	log.Infof("Check if remote state file %s exists", constants.ManagerStateFilename)
-	f, err := s.Backend.List()
+	f, err := s.Backend.List(ctx)
 	if err != nil {
 		return false, err
 	}
@@ -107,13 +131,70 @@ func (s *State) exists() (bool, error) {
 	}
 }
 
-func (s *State) updateState(i *Info) (err error) {
+// updateState writes the state if it has changed. If the backend supports
+// conditional writes, the state is only replaced if it hasn't been modified
+// by another writer since this manager last wrote it. Decorators implement
+// ConditionalWriter regardless of the wrapped backend, so
+// ErrConditionalWriteUnsupported falls back to an unconditional write.
+func (s *State) updateState(ctx context.Context, i *Info) error {
+	cw, ok := s.Backend.(backend.ConditionalWriter)
+	if !ok {
+		return s.overwriteState(ctx, i)
+	}
+
+	exists, err := s.exists(ctx)
+	if err != nil {
+		return err
+	}
+
+	var oldInfo *Info
+	version := ""
+	if exists {
+		oldInfo, version, err = s.readVersion(ctx, cw)
+		if errors.Is(err, backend.ErrConditionalWriteUnsupported) {
+			return s.overwriteState(ctx, i)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// don't check the remote version if this is our first update
+	if s.init && exists {
+		if version != s.version {
+			metrics.StateConflict()
+			return &ConcurrentWriterError{Info: oldInfo}
+		}
+		if reflect.DeepEqual(i, oldInfo) {
+			return nil
+		}
+	}
+
+	log.Debugf("Updating state %s.", i.ReleaseName)
+	version, err = s.writeIfMatch(ctx, cw, i, version)
+	if errors.Is(err, backend.ErrConditionalWriteUnsupported) {
+		return s.overwriteState(ctx, i)
+	}
+	if errors.Is(err, backend.ErrConflict) {
+		metrics.StateConflict()
+		return &ConcurrentWriterError{}
+	}
+	if err != nil {
+		return err
+	}
+	s.init, s.version = true, version
+	return nil
+}
+
+// overwriteState writes the state if it has changed without checking for
+// concurrent writers
+func (s *State) overwriteState(ctx context.Context, i *Info) (err error) {
 	update := false
 
 	// don't attempt to read the remote state if this is our first update
 	if s.init {
 		// check to see if the state is stale
-		oldInfo, e := s.read()
+		oldInfo, e := s.read(ctx)
 		if e != nil {
 			log.Warnf("Error reading remote state: %v", e)
 			update = true
@@ -128,7 +209,7 @@ func (s *State) updateState(i *Info) (err error) {
 
 	if update || !s.init {
 		log.Debugf("Updating state %s.", i.ReleaseName)
-		err = s.write(i)
+		err = s.write(ctx, i)
 		if err != nil {
 			return
 		}
@@ -136,19 +217,53 @@ func (s *State) updateState(i *Info) (err error) {
 	return err
 }
 
-func (s *State) read() (i *Info, err error) {
+func (s *State) read(ctx context.Context) (i *Info, err error) {
+	ctx, cancel := BackendContext(ctx, s.Config)
+	defer cancel()
+
 	log.Debugf("Reading state from %s", constants.ManagerStateFilename)
-	f, err := s.Backend.Read(constants.ManagerStateFilename)
+	f, err := s.Backend.Read(ctx, constants.ManagerStateFilename)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close() // nolint: errcheck
 
 	i = &Info{}
 	err = i.Deserialize(f)
 	return i, err
 }
 
-func (s *State) write(i *Info) error {
+func (s *State) readVersion(ctx context.Context, cw backend.ConditionalWriter) (*Info, string, error) {
+	ctx, cancel := BackendContext(ctx, s.Config)
+	defer cancel()
+
+	log.Debugf("Reading state from %s", constants.ManagerStateFilename)
+	f, version, err := cw.ReadVersion(ctx, constants.ManagerStateFilename)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close() // nolint: errcheck
+
+	i := &Info{}
+	err = i.Deserialize(f)
+	return i, version, err
+}
+
+func (s *State) writeIfMatch(ctx context.Context, cw backend.ConditionalWriter, i *Info, version string) (string, error) {
+	f, err := i.Serialize()
+	if err != nil {
+		return "", err
+	}
+	if s.Config.DryRun {
+		return version, nil
+	}
+
+	ctx, cancel := BackendContext(ctx, s.Config)
+	defer cancel()
+	return cw.WriteIfMatch(ctx, constants.ManagerStateFilename, f, version)
+}
+
+func (s *State) write(ctx context.Context, i *Info) error {
 	f, err := i.Serialize()
 	if err != nil {
 		return err
@@ -156,15 +271,22 @@ func (s *State) write(i *Info) error {
 	if s.Config.DryRun {
 		return nil
 	}
-	return s.Backend.Write(constants.ManagerStateFilename, f)
+
+	ctx, cancel := BackendContext(ctx, s.Config)
+	defer cancel()
+	return s.Backend.Write(ctx, constants.ManagerStateFilename, f)
 }
 
-func (s *State) delete() error {
+func (s *State) delete(ctx context.Context) error {
 	if s.Config.DryRun {
 		return nil
 	}
+
+	ctx, cancel := BackendContext(ctx, s.Config)
+	defer cancel()
+
 	log.Debugf("Removing remote state %s", constants.ManagerStateFilename)
-	return s.Backend.Delete(constants.ManagerStateFilename)
+	return s.Backend.Delete(ctx, constants.ManagerStateFilename)
 }
 
 func (s *State) isManagerRelease(name string) bool {
@@ -174,3 +296,11 @@ func (s *State) isManagerRelease(name string) bool {
 	}
 	return false
 }
+
+// BackendContext bounds a single backend operation by the configured timeout
+func BackendContext(ctx context.Context, c *config.Config) (context.Context, context.CancelFunc) {
+	if c.Backend.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.Backend.Timeout)
+}
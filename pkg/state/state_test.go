@@ -0,0 +1,88 @@
+package state
+
+import (
+	"context"
+	"testing"
+
+	"github.com/logicmonitor/k8s-release-manager/pkg/backend"
+	"github.com/logicmonitor/k8s-release-manager/pkg/config"
+	"github.com/logicmonitor/k8s-release-manager/pkg/release"
+	rls "helm.sh/helm/v3/pkg/release"
+)
+
+// unconditional hides the wrapped backend's ConditionalWriter implementation,
+// like the GCS, Azure and Kubernetes backends
+type unconditional struct {
+	backend.Backend
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend func(*config.BackendConfig) backend.Backend
+	}{
+		{
+			name: "conditional writes",
+			backend: func(cfg *config.BackendConfig) backend.Backend {
+				return &backend.Compressed{
+					Algorithm: backend.CompressionNone,
+					Backend:   &backend.Memory{BackendConfig: cfg},
+				}
+			},
+		},
+		{
+			name: "decorated backend without conditional writes",
+			backend: func(cfg *config.BackendConfig) backend.Backend {
+				return &backend.Compressed{
+					Algorithm: backend.CompressionNone,
+					Backend:   unconditional{&backend.Memory{BackendConfig: cfg}},
+				}
+			},
+		},
+		{
+			name: "backend without conditional writes",
+			backend: func(cfg *config.BackendConfig) backend.Backend {
+				return unconditional{&backend.Memory{BackendConfig: cfg}}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				Backend: &config.BackendConfig{StoragePath: "state"},
+				Export:  &config.ExportConfig{ReleaseName: "releasemanager"},
+			}
+			b := tt.backend(cfg.Backend)
+			err := b.Init(ctx)
+			if err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+
+			s := &State{Backend: b, Config: cfg}
+			err = s.Init()
+			if err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+
+			for version := 1; version <= 3; version++ {
+				r := &rls.Release{Name: "releasemanager", Namespace: "default", Version: version}
+				err = s.Update(ctx, []*rls.Release{r})
+				if err != nil {
+					t.Fatalf("Update to version %d: %v", version, err)
+				}
+
+				stored := &State{Backend: b, Config: cfg}
+				err = stored.Read(ctx)
+				if err != nil {
+					t.Fatalf("Read: %v", err)
+				}
+				want := &Info{ReleaseFilename: release.Filename(r), ReleaseName: r.Name, ReleaseVersion: int32(version)}
+				if stored.Info == nil || *stored.Info != *want {
+					t.Fatalf("stored state = %+v, want %+v", stored.Info, want)
+				}
+			}
+		})
+	}
+}
@@ -18,12 +18,13 @@ func FileExists(path string) bool {
 	}
 }
 
-// EnsureDirectory ensure that dir is a directory
-func EnsureDirectory(dir string) error {
+// EnsureDirectory ensure that dir is a directory, creating it and any missing
+// parents with the specified permissions
+func EnsureDirectory(dir string, perm os.FileMode) error {
 	_, err := os.Stat(dir)
 	if os.IsNotExist(err) {
 		log.Debugf("Creating directory %s", dir)
-		err = os.MkdirAll(dir, 0744)
+		err = os.MkdirAll(dir, perm)
 		if err != nil {
 			return err
 		}